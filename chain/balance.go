@@ -0,0 +1,244 @@
+package chain
+
+import (
+	"context"
+	"hash/crc32"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+// balancer picks the member of a backoffManager, it is called with the lock held.
+type balancer interface {
+	// next returns the index of the member to use, -1 if all are skipped.
+	next(ctx context.Context, u *backoffManager, target string, skip []bool) int
+}
+
+func newBalancer(node config.Node) balancer {
+	switch node.Strategy {
+	case config.StrategyRandom:
+		return randomBalancer{}
+	case config.StrategyWeighted:
+		return &weighted{
+			weights: node.Weights,
+			current: make([]int, len(node.Weights)),
+		}
+	case config.StrategyLeastActive:
+		return &leastActive{}
+	case config.StrategyLatency:
+		return latencyBalancer{}
+	case config.StrategyHash:
+		return newHashRing(node.LB, node.HashKey == config.HashKeyClient)
+	}
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	count int
+}
+
+func (r *roundRobin) next(ctx context.Context, u *backoffManager, target string, skip []bool) int {
+	n := len(u.addresses)
+	for i := 0; i < n; i++ {
+		index := (r.count + i) % n
+		if !skip[index] {
+			r.count = index + 1
+			return index
+		}
+	}
+	return -1
+}
+
+type randomBalancer struct{}
+
+func (randomBalancer) next(ctx context.Context, u *backoffManager, target string, skip []bool) int {
+	var candidates []int
+	for i := range u.addresses {
+		if !skip[i] {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	return candidates[rand.IntN(len(candidates))]
+}
+
+// weighted is the smooth weighted round-robin.
+type weighted struct {
+	weights []int
+	current []int
+}
+
+func (w *weighted) next(ctx context.Context, u *backoffManager, target string, skip []bool) int {
+	total := 0
+	index := -1
+	for i, weight := range w.weights {
+		if skip[i] {
+			continue
+		}
+		w.current[i] += weight
+		total += weight
+		if index < 0 || w.current[i] > w.current[index] {
+			index = i
+		}
+	}
+	if index < 0 {
+		return -1
+	}
+	w.current[index] -= total
+	return index
+}
+
+// leastActive picks the member with the least active connections.
+type leastActive struct {
+	count int
+}
+
+func (l *leastActive) next(ctx context.Context, u *backoffManager, target string, skip []bool) int {
+	n := len(u.addresses)
+	index := -1
+	for i := 0; i < n; i++ {
+		j := (l.count + i) % n
+		if skip[j] {
+			continue
+		}
+		if index < 0 || u.active[j] < u.active[index] {
+			index = j
+		}
+	}
+	if index < 0 {
+		return -1
+	}
+	l.count = index + 1
+	return index
+}
+
+// latencyBalancer picks the member with the least moving average of the dial time.
+type latencyBalancer struct{}
+
+func (latencyBalancer) next(ctx context.Context, u *backoffManager, target string, skip []bool) int {
+	index := -1
+	for i := range u.addresses {
+		if skip[i] {
+			continue
+		}
+		if index < 0 || u.latency[i] < u.latency[index] {
+			index = i
+		}
+	}
+	return index
+}
+
+const (
+	// latencyWeight is the weight of the new sample in the moving average of the dial time.
+	latencyWeight = 0.3
+	// latencyFailure is the sample of a failed dial.
+	latencyFailure = 10 * time.Second
+)
+
+// observeLatency adds the sample to the moving average of the member.
+func (u *backoffManager) observeLatency(index int, d time.Duration) {
+	if u.latency[index] == 0 {
+		u.latency[index] = d
+		return
+	}
+	u.latency[index] = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(u.latency[index]))
+}
+
+// hashRing is the consistent hashing of the members.
+type hashRing struct {
+	client  bool
+	hashes  []uint32
+	members []int
+}
+
+// hashReplicas is the number of the points of each member on the ring.
+const hashReplicas = 100
+
+func newHashRing(addresses []string, client bool) *hashRing {
+	r := &hashRing{
+		client: client,
+	}
+	type point struct {
+		hash   uint32
+		member int
+	}
+	points := make([]point, 0, len(addresses)*hashReplicas)
+	for i, address := range addresses {
+		for j := 0; j < hashReplicas; j++ {
+			points = append(points, point{
+				hash:   crc32.ChecksumIEEE([]byte(strconv.Itoa(j) + "#" + address)),
+				member: i,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+	for _, p := range points {
+		r.hashes = append(r.hashes, p.hash)
+		r.members = append(r.members, p.member)
+	}
+	return r
+}
+
+func (r *hashRing) next(ctx context.Context, u *backoffManager, target string, skip []bool) int {
+	key := target
+	if r.client {
+		if addr := clientAddr(ctx); addr != "" {
+			key = addr
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				key = host
+			}
+		}
+	}
+	if len(r.hashes) == 0 {
+		return -1
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= hash
+	})
+	for i := 0; i < len(r.hashes); i++ {
+		member := r.members[(start+i)%len(r.hashes)]
+		if !skip[member] {
+			return member
+		}
+	}
+	return -1
+}
+
+// hashesClient reports whether a node of the chain picks the member by the address of the client.
+func hashesClient(chain config.Chain) bool {
+	nodes := slices.Clone(chain.Proxy)
+	for _, hops := range chain.Backups {
+		nodes = append(nodes, hops...)
+	}
+	for _, hops := range chain.Routes {
+		nodes = append(nodes, hops...)
+	}
+	for _, node := range nodes {
+		if node.Strategy == config.StrategyHash && node.HashKey == config.HashKeyClient {
+			return true
+		}
+	}
+	return false
+}
+
+type clientAddrKey struct{}
+
+// withClientAddr returns the ctx with the address of the client.
+func withClientAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+func clientAddr(ctx context.Context) string {
+	addr, _ := ctx.Value(clientAddrKey{}).(string)
+	return addr
+}
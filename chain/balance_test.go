@@ -0,0 +1,184 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+// fakeMembers dials a pipe through each member, the members in fail could not be reached,
+// the reached members refuse to dial the targets in dead.
+type fakeMembers struct {
+	mut   sync.Mutex
+	fail  map[string]bool
+	dead  map[string]bool
+	dials []string
+}
+
+func (f *fakeMembers) bridge(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+	return bridge.DialFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+		f.mut.Lock()
+		defer f.mut.Unlock()
+		f.dials = append(f.dials, address)
+		if f.fail[address] {
+			unreached(ctx)
+			return nil, errors.New("refused")
+		}
+		if f.dead[target] {
+			return nil, errors.New("refused by the target")
+		}
+		c, _ := net.Pipe()
+		return c, nil
+	}), nil
+}
+
+func (f *fakeMembers) picked() []string {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	dials := f.dials
+	f.dials = nil
+	return dials
+}
+
+func dialN(t *testing.T, ctx context.Context, d bridge.Dialer, targets ...string) []net.Conn {
+	var conns []net.Conn
+	for _, target := range targets {
+		conn, err := d.DialContext(ctx, "tcp", target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func TestBalancer(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		node  config.Node
+		dials []string
+		want  []string
+	}{
+		{
+			name:  "default",
+			node:  config.Node{LB: []string{"a", "b"}},
+			dials: []string{"x:1", "x:1", "x:1"},
+			want:  []string{"a", "b", "a"},
+		},
+		{
+			name:  "round-robin",
+			node:  config.Node{LB: []string{"a", "b", "c"}, Strategy: config.StrategyRoundRobin},
+			dials: []string{"x:1", "x:1", "x:1", "x:1"},
+			want:  []string{"a", "b", "c", "a"},
+		},
+		{
+			name:  "weighted",
+			node:  config.Node{LB: []string{"a", "b"}, Strategy: config.StrategyWeighted, Weights: []int{3, 1}},
+			dials: []string{"x:1", "x:1", "x:1", "x:1"},
+			want:  []string{"a", "a", "b", "a"},
+		},
+		{
+			name:  "hash target",
+			node:  config.Node{LB: []string{"a", "b", "c"}, Strategy: config.StrategyHash},
+			dials: []string{"x:1", "y:1", "x:1", "y:1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeMembers{}
+			u := newBackoffManager(nil, f.bridge, tt.node)
+			dialN(t, ctx, u, tt.dials...)
+			got := f.picked()
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+			if tt.node.Strategy == config.StrategyHash && (got[0] != got[2] || got[1] != got[3]) {
+				t.Errorf("picked %v, want the same member for the same target", got)
+			}
+		})
+	}
+}
+
+func TestBalancerLeastActive(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeMembers{}
+	u := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a", "b"}, Strategy: config.StrategyLeastActive})
+	conns := dialN(t, ctx, u, "x:1", "x:1")
+	conns[0].Close()
+	dialN(t, ctx, u, "x:1")
+	if got, want := f.picked(), []string{"a", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+}
+
+func TestBalancerLatency(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeMembers{}
+	u := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a", "b"}, Strategy: config.StrategyLatency})
+	u.latency = []time.Duration{time.Second, time.Millisecond}
+	dialN(t, ctx, u, "x:1")
+	if got, want := f.picked(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+}
+
+func TestBalancerHashClient(t *testing.T) {
+	f := &fakeMembers{}
+	u := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a", "b", "c"}, Strategy: config.StrategyHash, HashKey: config.HashKeyClient})
+	for _, client := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		ctx := withClientAddr(context.Background(), client+":1000")
+		dialN(t, ctx, u, "x:1")
+		ctx = withClientAddr(context.Background(), client+":2000")
+		dialN(t, ctx, u, "y:1")
+		got := f.picked()
+		if got[0] != got[1] {
+			t.Errorf("client %s picked %v, want the same member", client, got)
+		}
+	}
+}
+
+func TestHashesClient(t *testing.T) {
+	client := config.Node{LB: []string{"a", "b"}, Strategy: config.StrategyHash, HashKey: config.HashKeyClient}
+	target := config.Node{LB: []string{"a", "b"}, Strategy: config.StrategyHash}
+	dial := config.Node{LB: []string{"-"}}
+	tests := []struct {
+		name  string
+		chain config.Chain
+		want  bool
+	}{
+		{name: "proxy", chain: config.Chain{Proxy: []config.Node{dial, client}}, want: true},
+		{name: "backup", chain: config.Chain{Proxy: []config.Node{dial, target}, Backups: [][]config.Node{{client}}}, want: true},
+		{name: "route", chain: config.Chain{Proxy: []config.Node{dial}, Routes: map[string][]config.Node{"corp": {client}}}, want: true},
+		{name: "target", chain: config.Chain{Proxy: []config.Node{dial, target}}},
+	}
+	for _, tt := range tests {
+		if got := hashesClient(tt.chain); got != tt.want {
+			t.Errorf("%s: hashesClient() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBalancerFailover(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeMembers{fail: map[string]bool{"a": true}}
+	u := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a", "b"}, Strategy: config.StrategyRoundRobin})
+	dialN(t, ctx, u, "x:1")
+	if got, want := f.picked(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+
+	f.fail["b"] = true
+	_, err := u.DialContext(ctx, "tcp", "x:1")
+	if err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("DialContext() error = %v, want refused", err)
+	}
+}
@@ -0,0 +1,106 @@
+package chain
+
+import (
+	"time"
+)
+
+const (
+	// breakerThreshold is the number of the consecutive failures to open the circuit.
+	breakerThreshold = 3
+	// breakerCooldown is the time the circuit stays open before a trial, it is doubled on each failed trial.
+	breakerCooldown    = 5 * time.Second
+	breakerMaxCooldown = 5 * time.Minute
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker is the circuit breaker of a member, it is used with the lock of the backoffManager held.
+type breaker struct {
+	state    breakerState
+	failures int
+	cooldown time.Duration
+	until    time.Time
+	// trial is true if the trial of the half-open circuit is in flight.
+	trial bool
+}
+
+// available reports whether the member can be used.
+func (b *breaker) available(now time.Time) bool {
+	switch b.state {
+	case breakerOpen:
+		if now.Before(b.until) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = false
+		return true
+	case breakerHalfOpen:
+		return !b.trial
+	}
+	return true
+}
+
+// acquire marks the member as used.
+func (b *breaker) acquire() {
+	if b.state == breakerHalfOpen {
+		b.trial = true
+	}
+}
+
+// release ends the trial of the half-open circuit without a result.
+func (b *breaker) release() {
+	if b.state == breakerHalfOpen {
+		b.trial = false
+	}
+}
+
+// success closes the circuit, and reports whether the state is changed.
+func (b *breaker) success() bool {
+	b.failures = 0
+	if b.state == breakerClosed {
+		return false
+	}
+	b.state = breakerClosed
+	b.cooldown = 0
+	b.trial = false
+	return true
+}
+
+// failure counts the failure, and reports whether the circuit is opened.
+func (b *breaker) failure(now time.Time) bool {
+	switch b.state {
+	case breakerHalfOpen:
+		b.cooldown *= 2
+		if b.cooldown > breakerMaxCooldown {
+			b.cooldown = breakerMaxCooldown
+		}
+	case breakerClosed:
+		b.failures++
+		if b.failures < breakerThreshold {
+			return false
+		}
+		b.cooldown = breakerCooldown
+	default:
+		return false
+	}
+	b.state = breakerOpen
+	b.trial = false
+	b.until = now.Add(b.cooldown)
+	return true
+}
@@ -0,0 +1,211 @@
+package chain
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	tests := []struct {
+		name      string
+		steps     func(b *breaker)
+		after     time.Duration
+		want      breakerState
+		available bool
+	}{
+		{
+			name: "closed under the threshold",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+			},
+			want:      breakerClosed,
+			available: true,
+		},
+		{
+			name: "opened at the threshold",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+				b.failure(now)
+			},
+			want: breakerOpen,
+		},
+		{
+			name: "success resets the failures",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+				b.success()
+				b.failure(now)
+			},
+			want:      breakerClosed,
+			available: true,
+		},
+		{
+			name: "half-open after the cooldown",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+				b.failure(now)
+			},
+			after:     breakerCooldown,
+			want:      breakerHalfOpen,
+			available: true,
+		},
+		{
+			name: "one trial at a time",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+				b.failure(now)
+				b.available(now.Add(breakerCooldown))
+				b.acquire()
+			},
+			after: breakerCooldown,
+			want:  breakerHalfOpen,
+		},
+		{
+			name: "failed trial doubles the cooldown",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+				b.failure(now)
+				b.available(now.Add(breakerCooldown))
+				b.acquire()
+				b.failure(now)
+			},
+			after: breakerCooldown,
+			want:  breakerOpen,
+		},
+		{
+			name: "succeeded trial closes",
+			steps: func(b *breaker) {
+				b.failure(now)
+				b.failure(now)
+				b.failure(now)
+				b.available(now.Add(breakerCooldown))
+				b.acquire()
+				b.success()
+			},
+			want:      breakerClosed,
+			available: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &breaker{}
+			tt.steps(b)
+			if got := b.available(now.Add(tt.after)); got != tt.available {
+				t.Errorf("available() = %v, want %v", got, tt.available)
+			}
+			if b.state != tt.want {
+				t.Errorf("state = %v, want %v", b.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffManagerBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	f := &fakeMembers{fail: map[string]bool{"a": true}}
+	u := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a", "b"}})
+	u.now = func() time.Time { return now }
+
+	// a is tried in turn until its circuit is open.
+	dialN(t, ctx, u, "x:1", "x:1", "x:1", "x:1", "x:1")
+	if got, want := f.picked(), []string{"a", "b", "a", "b", "a", "b", "b", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+
+	// a recovers, but it is skipped until the cooldown is over.
+	f.mut.Lock()
+	f.fail["a"] = false
+	f.mut.Unlock()
+	dialN(t, ctx, u, "x:1", "x:1")
+	if got, want := f.picked(), []string{"b", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+
+	now = now.Add(breakerCooldown)
+	dialN(t, ctx, u, "x:1", "x:1", "x:1")
+	if got, want := f.picked(), []string{"a", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+
+	// All circuits are open, the members are still tried since none is left.
+	f.mut.Lock()
+	f.fail["a"], f.fail["b"] = true, true
+	f.mut.Unlock()
+	for i := 0; i < 3; i++ {
+		u.DialContext(ctx, "tcp", "x:1")
+	}
+	f.picked()
+	f.mut.Lock()
+	f.fail["a"] = false
+	f.mut.Unlock()
+	dialN(t, ctx, u, "x:1")
+	if got, want := f.picked(), []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+}
+
+func TestBackoffManagerBreakerTarget(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeMembers{dead: map[string]bool{"dead:1": true}}
+	u := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a"}})
+
+	// The target refused by the member does not open its circuit.
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := u.DialContext(ctx, "tcp", "dead:1"); err == nil || isUnreached(err) {
+			t.Fatalf("DialContext() error = %v, want the error of the target", err)
+		}
+	}
+	dialN(t, ctx, u, "alive:1")
+	if u.breakers[0].state != breakerClosed {
+		t.Errorf("state = %v, want %v", u.breakers[0].state, breakerClosed)
+	}
+}
+
+func TestBackoffManagerBreakerCanceled(t *testing.T) {
+	var built int
+	build := func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		built++
+		return bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			unreached(ctx)
+			return nil, ctx.Err()
+		}), nil
+	}
+	u := newBackoffManager(nil, build, config.Node{LB: []string{"a"}})
+
+	// The caller that gives up while the member is dialing does not count against it.
+	for i := 0; i < breakerThreshold; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		u.DialContext(ctx, "tcp", "x:1")
+		cancel()
+	}
+	if u.breakers[0].state != breakerClosed || u.breakers[0].failures != 0 {
+		t.Errorf("state = %v with %d failures, want %v", u.breakers[0].state, u.breakers[0].failures, breakerClosed)
+	}
+	if u.dialers[0] == nil || built != 1 {
+		t.Errorf("built %d dialers, want the first one kept", built)
+	}
+
+	// The timeout of the attempt still counts.
+	u.retry.timeout = 10 * time.Millisecond
+	for i := 0; i < breakerThreshold; i++ {
+		u.DialContext(context.Background(), "tcp", "x:1")
+	}
+	if u.breakers[0].state != breakerOpen {
+		t.Errorf("state = %v, want %v", u.breakers[0].state, breakerOpen)
+	}
+}
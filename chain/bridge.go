@@ -2,6 +2,7 @@ package chain
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,15 +12,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wzshiming/anyproxy"
 	"github.com/wzshiming/bridge"
 	"github.com/wzshiming/bridge/config"
 	"github.com/wzshiming/bridge/internal/dump"
+	"github.com/wzshiming/bridge/internal/expand"
 	"github.com/wzshiming/bridge/internal/idle"
 	"github.com/wzshiming/bridge/internal/netutils"
 	"github.com/wzshiming/bridge/internal/pool"
+	"github.com/wzshiming/bridge/internal/route"
 	"github.com/wzshiming/bridge/internal/scheme"
 	"github.com/wzshiming/bridge/logger"
 	"github.com/wzshiming/bridge/protocols/local"
@@ -27,10 +31,36 @@ import (
 	"github.com/wzshiming/hostmatcher"
 )
 
+// ErrNotRunning is returned when updating a chain that is not running.
+var ErrNotRunning = errors.New("chain is not running")
+
 type Bridge struct {
 	logger *slog.Logger
 	dump   bool
 	chain  *BridgeChain
+
+	ready     func(err error)
+	readyOnce sync.Once
+
+	// ctx is the lifetime of the running chain.
+	ctx          context.Context
+	listenUnique string
+	state        atomic.Pointer[dialState]
+
+	conns connTracker
+}
+
+// dialState is the dial side of a chain, it can be swapped without closing the listeners.
+type dialState struct {
+	dialer      bridge.Dialer
+	dials       []string
+	allow       hostmatcher.Matcher
+	idleTimeout time.Duration
+	// hashClient is true if a node picks the member by the address of the client.
+	hashClient bool
+	// firsts are the groups of the first hops of the proxy and of the backups, nil if it dials directly.
+	firsts []*backoffManager
+	cancel func()
 }
 
 func NewBridge(logger *slog.Logger, dump bool) *Bridge {
@@ -41,22 +71,149 @@ func NewBridge(logger *slog.Logger, dump bool) *Bridge {
 	}
 }
 
+// NotifyReady sets the function that is called once the chain is working or failed.
+func (b *Bridge) NotifyReady(fn func(err error)) {
+	b.ready = fn
+}
+
+func (b *Bridge) notifyReady(err error) {
+	if b.ready == nil {
+		return
+	}
+	b.readyOnce.Do(func() {
+		b.ready(err)
+	})
+}
+
+// WithChain returns the logger with the name and labels of the chain.
+func WithChain(log *slog.Logger, config config.Chain) *slog.Logger {
+	if config.Name != "" {
+		log = log.With("chain_name", config.Name)
+	}
+	if len(config.Labels) != 0 {
+		log = log.With("chain_labels", config.Labels)
+	}
+	return log
+}
+
 func (b *Bridge) BridgeWithConfig(ctx context.Context, config config.Chain) error {
-	var (
-		dialer       bridge.Dialer       = local.LOCAL
-		listenConfig bridge.ListenConfig = local.LOCAL
-	)
-	dial := config.Proxy[0]
+	b.logger = WithChain(b.logger, config)
+	if config.Debug != nil {
+		b.dump = *config.Debug
+	}
+	err := b.bridgeWithConfig(ctx, config)
+	if err != nil {
+		b.notifyReady(err)
+	} else {
+		// It is not ready if it exits before being ready.
+		b.notifyReady(fmt.Errorf("chain exited"))
+	}
+	return err
+}
+
+// Update swaps the dial side of the running chain, and the listeners are kept.
+// The config must have the same listen side, see config.Chain.ListenUnique.
+func (b *Bridge) Update(ctx context.Context, config config.Chain) error {
+	if b.state.Load() == nil || b.ctx.Err() != nil {
+		return ErrNotRunning
+	}
+	if b.listenUnique != config.ListenUnique() {
+		return fmt.Errorf("the listen side of the chain is changed")
+	}
+	state, err := b.newDialState(b.ctx, config)
+	if err != nil {
+		return err
+	}
+	err = state.probe(ctx)
+	if err != nil {
+		state.cancel()
+		return err
+	}
+	b.state.Swap(state).cancel()
+	return nil
+}
+
+// Probe checks that the first hop of the dial side can be reached.
+func (b *Bridge) Probe(ctx context.Context) error {
+	state := b.state.Load()
+	if state == nil {
+		return ErrNotRunning
+	}
+	return state.probe(ctx)
+}
+
+func (b *Bridge) newDialState(ctx context.Context, config config.Chain) (*dialState, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var dialer bridge.Dialer = local.LOCAL
+	var firsts []*backoffManager
 	dials := config.Proxy[1:]
+	if len(config.Backups) != 0 {
+		d, err := b.newChainFailover(ctx, config)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		dialer = d
+		firsts = d.firsts
+	} else if len(dials) != 0 {
+		d, first, err := b.chain.bridgeChainWithFirst(ctx, b.logger, local.LOCAL, withRetry(dials, config.Retry)...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		dialer = d
+		firsts = []*backoffManager{first}
+	}
 
-	if len(dials) != 0 {
-		d, err := b.chain.BridgeChainWithConfig(ctx, local.LOCAL, dials...)
+	if len(config.Rules) != 0 {
+		d, err := b.newRuleDialer(ctx, config, dialer)
 		if err != nil {
-			return err
+			cancel()
+			return nil, err
 		}
 		dialer = d
 	}
 
+	var allow hostmatcher.Matcher
+	if len(config.Allow) != 0 {
+		m, err := route.NewHostMatcher(config.Allow)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		route.WatchLists(ctx, b.logger, m.Lists())
+		allow = m
+	}
+	return &dialState{
+		dialer:      dialer,
+		dials:       config.Proxy[0].LB,
+		allow:       allow,
+		idleTimeout: config.IdleTimeout,
+		hashClient:  hashesClient(config),
+		firsts:      firsts,
+		cancel:      cancel,
+	}, nil
+}
+
+// dialContext dials with the current dialer.
+func (b *Bridge) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return b.state.Load().dialer.DialContext(ctx, network, address)
+}
+
+func (b *Bridge) bridgeWithConfig(ctx context.Context, config config.Chain) error {
+	var listenConfig bridge.ListenConfig = local.LOCAL
+
+	state, err := b.newDialState(ctx, config)
+	if err != nil {
+		return err
+	}
+	b.ctx = ctx
+	b.listenUnique = config.ListenUnique()
+	b.state.Store(state)
+	defer func() {
+		b.state.Load().cancel()
+	}()
+
 	// No listener is set, use stdio.
 	if len(config.Bind) == 0 {
 		var raw io.ReadWriteCloser = struct {
@@ -68,22 +225,18 @@ func (b *Bridge) BridgeWithConfig(ctx context.Context, config config.Chain) erro
 		}
 
 		if b.dump {
-			raw = dump.NewDumpReadWriteCloser(raw, true, "STDIO", strings.Join(dial.LB, "|"))
+			raw = dump.NewDumpReadWriteCloser(raw, true, "STDIO", strings.Join(state.dials, "|"))
 		}
 
-		return step(ctx, dialer, raw, dial.LB)
-	}
-
-	var allow hostmatcher.Matcher
-	if len(config.Allow) != 0 {
-		allow = hostmatcher.NewMatcher(config.Allow)
+		b.notifyReady(nil)
+		return step(ctx, state.dialer, raw, state.dials)
 	}
 
 	listen := config.Bind[0]
 	listens := config.Bind[1:]
 
 	if len(listens) != 0 {
-		d, err := b.chain.BridgeChainWithConfig(ctx, local.LOCAL, listens...)
+		d, err := b.chain.bridgeChainWithLogger(ctx, b.logger, local.LOCAL, withRetry(listens, config.Retry)...)
 		if err != nil {
 			return err
 		}
@@ -94,10 +247,10 @@ func (b *Bridge) BridgeWithConfig(ctx context.Context, config config.Chain) erro
 		listenConfig = l
 	}
 
-	if len(dial.LB) != 0 && dial.LB[0] == "-" {
-		return b.bridgeProxy(ctx, listenConfig, dialer, config.IdleTimeout, listen.LB, allow)
+	if config.IsProxyMode() {
+		return b.bridgeProxy(ctx, listenConfig, listen.LB)
 	} else {
-		return b.bridgeStream(ctx, listenConfig, dialer, config.IdleTimeout, listen.LB, dial.LB, allow)
+		return b.bridgeStream(ctx, listenConfig, listen.LB)
 	}
 }
 
@@ -109,8 +262,10 @@ func (b *Bridge) Bridge(ctx context.Context, listens, dials []string) error {
 	return b.BridgeWithConfig(ctx, conf[0])
 }
 
-func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenConfig, dialer bridge.Dialer, idleTimeout time.Duration, listens []string, dials []string, allow hostmatcher.Matcher) error {
+func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenConfig, listens []string) error {
 	wg := sync.WaitGroup{}
+	mut := sync.Mutex{}
+	bound := b.newBoundGroup(len(listens))
 
 	listeners := make([]net.Listener, len(listens))
 	for i, l := range listens {
@@ -121,17 +276,32 @@ func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenCon
 			network, listen, ok := scheme.SplitSchemeAddr(l)
 			if !ok {
 				b.logger.Error("unsupported protocol format", "address", l)
+				bound.done(fmt.Errorf("unsupported protocol format %q", l))
 				return
 			}
 			listener, err := netutils.Listen(ctx, listenConfig, network, listen)
 			if err != nil {
 				b.logger.Error("Listen", "err", err)
+				bound.done(err)
 				return
 			}
+			mut.Lock()
 			listeners[i] = listener
+			mut.Unlock()
+			bound.done(nil)
+
+			// Unblock the Accept when the ctx is done.
+			stop := context.AfterFunc(ctx, func() {
+				mut.Lock()
+				defer mut.Unlock()
+				listeners[i].Close()
+			})
+			defer stop()
 
 			defer func() {
 				b.logger.Info("Close listener", "listen", l)
+				mut.Lock()
+				defer mut.Unlock()
 				listeners[i].Close()
 			}()
 
@@ -159,8 +329,10 @@ func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenCon
 						}
 						listener, err = netutils.Listen(ctx, listenConfig, network, listen)
 						if err == nil {
+							mut.Lock()
 							listeners[i].Close()
 							listeners[i] = listener
+							mut.Unlock()
 							continue loop
 						}
 						b.logger.Error("Relisten", "err", err)
@@ -168,14 +340,15 @@ func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenCon
 					return
 				}
 
-				if allow != nil {
+				state := b.state.Load()
+				if state.allow != nil {
 					host, _, err := net.SplitHostPort(raw.RemoteAddr().String())
 					if err != nil {
 						b.logger.Error("SplitHostPort", "err", err)
 						raw.Close()
 						continue
 					}
-					if !allow.Match(host) {
+					if !state.allow.Match(host) {
 						b.logger.Warn("connection from remote address not in allow", "remote_addr", raw.RemoteAddr().String())
 						raw.Close()
 						continue
@@ -183,13 +356,17 @@ func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenCon
 				}
 
 				if b.dump {
-					raw = dump.NewDumpConn(raw, true, raw.RemoteAddr().String(), strings.Join(dials, "|"))
+					raw = dump.NewDumpConn(raw, true, raw.RemoteAddr().String(), strings.Join(state.dials, "|"))
 				}
-				if idleTimeout != 0 {
-					raw = idle.NewIdleConn(raw, idleTimeout)
+				if state.idleTimeout != 0 {
+					raw = idle.NewIdleConn(raw, state.idleTimeout)
 				}
 				backoff = time.Second / 10
-				go b.stepIgnoreErr(ctx, dialer, raw, dials)
+				untrack := b.conns.track(raw)
+				go func(raw net.Conn) {
+					defer untrack()
+					b.stepIgnoreErr(withClientAddr(ctx, raw.RemoteAddr().String()), state.dialer, raw, state.dials)
+				}(raw)
 			}
 		}(i, l)
 	}
@@ -197,9 +374,12 @@ func (b *Bridge) bridgeStream(ctx context.Context, listenConfig bridge.ListenCon
 	return nil
 }
 
-func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConfig, dialer bridge.Dialer, idleTimeout time.Duration, listens []string, allow hostmatcher.Matcher) error {
+func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConfig, listens []string) error {
 	wg := sync.WaitGroup{}
-	svc, err := anyproxy.NewAnyProxy(ctx, listens, &anyproxy.Config{
+	dialer := bridge.DialFunc(b.dialContext)
+	// The tunnels are drained, see Bridge.Drain.
+	serveCtx := context.WithoutCancel(ctx)
+	svc, err := anyproxy.NewAnyProxy(serveCtx, listens, &anyproxy.Config{
 		Dialer:       dialer,
 		ListenConfig: listenConfig,
 		Logger:       logger.Wrap(b.logger, "anyproxy"),
@@ -209,6 +389,22 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 		return err
 	}
 	hosts := svc.Hosts()
+	mut := sync.Mutex{}
+	bound := b.newBoundGroup(len(hosts))
+	clients := &clientHandlers{
+		handlers: map[string]*clientHandler{},
+		new: func(client string) (*anyproxy.AnyProxy, error) {
+			dial := bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+				return netutils.Dial(withClientAddr(ctx, client), dialer, network, address)
+			})
+			return anyproxy.NewAnyProxy(serveCtx, listens, &anyproxy.Config{
+				Dialer:       dial,
+				ListenConfig: listenConfig,
+				Logger:       logger.Wrap(b.logger, "anyproxy"),
+				BytesPool:    pool.Bytes,
+			})
+		},
+	}
 
 	listeners := make([]net.Listener, len(listens))
 	for i, host := range hosts {
@@ -219,12 +415,27 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 			listener, err := netutils.Listen(ctx, listenConfig, "tcp", host)
 			if err != nil {
 				b.logger.Error("Listen", "err", err)
+				bound.done(err)
 				return
 			}
 
+			mut.Lock()
 			listeners[i] = listener
+			mut.Unlock()
+			bound.done(nil)
+
+			// Unblock the Accept when the ctx is done.
+			stop := context.AfterFunc(ctx, func() {
+				mut.Lock()
+				defer mut.Unlock()
+				listeners[i].Close()
+			})
+			defer stop()
+
 			defer func() {
 				b.logger.Info("Close listener", "listen", host)
+				mut.Lock()
+				defer mut.Unlock()
 				listeners[i].Close()
 			}()
 
@@ -248,8 +459,10 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 
 						listener, err = netutils.Listen(ctx, listenConfig, "tcp", host)
 						if err == nil {
+							mut.Lock()
 							listeners[i].Close()
 							listeners[i] = listener
+							mut.Unlock()
 							continue loop
 						}
 						b.logger.Error("Relisten", "err", err)
@@ -257,14 +470,15 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 					return
 				}
 
-				if allow != nil {
+				state := b.state.Load()
+				if state.allow != nil {
 					host, _, err := net.SplitHostPort(raw.RemoteAddr().String())
 					if err != nil {
 						b.logger.Error("SplitHostPort", "err", err)
 						raw.Close()
 						continue
 					}
-					if !allow.Match(host) {
+					if !state.allow.Match(host) {
 						b.logger.Warn("connection from remote address not in allow", "remote_addr", raw.RemoteAddr().String())
 						raw.Close()
 						continue
@@ -272,17 +486,19 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 				}
 
 				h := h
+				release := func() {}
 				if b.dump {
 					// In dubug mode, need to know the address of the client.
 					// Because it is debug, performance is not considered here.
-					dial := bridge.DialFunc(func(ctx context.Context, network, address string) (c net.Conn, err error) {
-						c, err = netutils.Dial(ctx, dialer, network, address)
+					remoteAddr := raw.RemoteAddr().String()
+					dial := bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+						c, err := netutils.Dial(withClientAddr(ctx, remoteAddr), dialer, network, address)
 						if err != nil {
 							return nil, err
 						}
-						return dump.NewDumpConn(c, false, raw.RemoteAddr().String(), address), nil
+						return dump.NewDumpConn(c, false, remoteAddr, address), nil
 					})
-					svc, err := anyproxy.NewAnyProxy(ctx, listens, &anyproxy.Config{
+					svc, err := anyproxy.NewAnyProxy(serveCtx, listens, &anyproxy.Config{
 						Dialer:       dial,
 						ListenConfig: listenConfig,
 						Logger:       logger.Wrap(b.logger, "anyproxy"),
@@ -294,12 +510,33 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 						return
 					}
 					h = svc.Match(host)
+				} else if state.hashClient {
+					// The connections of the same host share a handler.
+					client, _, err := net.SplitHostPort(raw.RemoteAddr().String())
+					if err != nil {
+						b.logger.Error("SplitHostPort", "err", err)
+						raw.Close()
+						continue
+					}
+					svc, put, err := clients.get(client)
+					if err != nil {
+						b.logger.Error("NewAnyProxy", "err", err)
+						raw.Close()
+						continue
+					}
+					h = svc.Match(host)
+					release = put
 				}
-				if idleTimeout != 0 {
-					raw = idle.NewIdleConn(raw, idleTimeout)
+				if state.idleTimeout != 0 {
+					raw = idle.NewIdleConn(raw, state.idleTimeout)
 				}
 				backoff = time.Second / 10
-				go h.ServeConn(raw)
+				untrack := b.conns.track(raw)
+				go func(raw net.Conn) {
+					defer untrack()
+					defer release()
+					h.ServeConn(raw)
+				}(raw)
 			}
 		}(i, host)
 	}
@@ -307,6 +544,105 @@ func (b *Bridge) bridgeProxy(ctx context.Context, listenConfig bridge.ListenConf
 	return nil
 }
 
+// clientHandlers shares the handlers of the proxy mode among the connections of the same client host.
+type clientHandlers struct {
+	mut      sync.Mutex
+	handlers map[string]*clientHandler
+	new      func(client string) (*anyproxy.AnyProxy, error)
+}
+
+type clientHandler struct {
+	svc  *anyproxy.AnyProxy
+	refs int
+}
+
+// get returns the handler of the client, and the function to release it once the connection is finished.
+func (c *clientHandlers) get(client string) (*anyproxy.AnyProxy, func(), error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	h, ok := c.handlers[client]
+	if !ok {
+		svc, err := c.new(client)
+		if err != nil {
+			return nil, nil, err
+		}
+		h = &clientHandler{svc: svc}
+		c.handlers[client] = h
+	}
+	h.refs++
+	return h.svc, func() {
+		c.mut.Lock()
+		defer c.mut.Unlock()
+		h.refs--
+		if h.refs == 0 {
+			delete(c.handlers, client)
+		}
+	}, nil
+}
+
+// boundGroup notifies the ready once all the listeners are bound or failed.
+type boundGroup struct {
+	b    *Bridge
+	mut  sync.Mutex
+	left int
+	errs []error
+}
+
+func (b *Bridge) newBoundGroup(n int) *boundGroup {
+	g := &boundGroup{
+		b:    b,
+		left: n,
+	}
+	if n == 0 {
+		b.notifyReady(fmt.Errorf("no listener"))
+	}
+	return g
+}
+
+func (g *boundGroup) done(err error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if err != nil {
+		g.errs = append(g.errs, err)
+	}
+	g.left--
+	if g.left == 0 {
+		g.b.notifyReady(errors.Join(g.errs...))
+	}
+}
+
+// probeTimeout is the time to wait for the first hop when probing the dial side.
+const probeTimeout = 5 * time.Second
+
+// probe checks that one of the first hops can be reached.
+func (s *dialState) probe(ctx context.Context) error {
+	if len(s.firsts) == 0 {
+		return nil
+	}
+	for _, first := range s.firsts {
+		if first == nil {
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	results := make(chan error, len(s.firsts))
+	for _, first := range s.firsts {
+		go func(first *backoffManager) {
+			results <- first.handshake(ctx)
+		}(first)
+	}
+	var errs []error
+	for range s.firsts {
+		err := <-results
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
 func ignoreClosedErr(err error) error {
 	if err != nil && err != io.EOF && err != io.ErrClosedPipe && !netutils.IsClosedConnError(err) {
 		return err
@@ -333,7 +669,8 @@ func step(ctx context.Context, dialer bridge.Dialer, raw io.ReadWriteCloser, dia
 		return fmt.Errorf("unsupported protocol format %q", address)
 	}
 
-	conn, err := netutils.Dial(ctx, dialer, network, address)
+	// The accepted connection is drained, see Bridge.Drain.
+	conn, err := netutils.Dial(context.WithoutCancel(ctx), dialer, network, address)
 	if err != nil {
 		return err
 	}
@@ -343,6 +680,7 @@ func step(ctx context.Context, dialer bridge.Dialer, raw io.ReadWriteCloser, dia
 		pool.Bytes.Put(buf1)
 		pool.Bytes.Put(buf2)
 	}()
+
 	return commandproxy.Tunnel(context.Background(), conn, raw, buf1, buf2)
 }
 
@@ -371,7 +709,7 @@ func ShowChain(dials, listens []string) string {
 func removeUserInfo(addresses []string) []string {
 	addresses = stringsClone(addresses)
 	for i := 0; i != len(addresses); i++ {
-		address := strings.Split(addresses[i], "|")
+		address := expand.Split(addresses[i], "|")
 		for j := 0; j != len(address); j++ {
 			sch, addr, ok := scheme.SplitSchemeAddr(address[j])
 			if !ok {
@@ -0,0 +1,62 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/wzshiming/anyproxy"
+	"github.com/wzshiming/bridge/config"
+)
+
+func TestWithChain(t *testing.T) {
+	var buf bytes.Buffer
+	log := WithChain(slog.New(slog.NewJSONHandler(&buf, nil)), config.Chain{
+		Name:   "web",
+		Labels: map[string]string{"team": "infra"},
+	})
+	log.Info("Accept")
+
+	var got struct {
+		Name   string            `json:"chain_name"`
+		Labels map[string]string `json:"chain_labels"`
+	}
+	err := json.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "web" || !reflect.DeepEqual(got.Labels, map[string]string{"team": "infra"}) {
+		t.Errorf("WithChain() logged %s", buf.String())
+	}
+}
+
+func TestClientHandlers(t *testing.T) {
+	var built []string
+	c := &clientHandlers{
+		handlers: map[string]*clientHandler{},
+		new: func(client string) (*anyproxy.AnyProxy, error) {
+			built = append(built, client)
+			return &anyproxy.AnyProxy{}, nil
+		},
+	}
+
+	// The connections of the same host share the handler while one is active.
+	a1, release1, _ := c.get("10.0.0.1")
+	a2, release2, _ := c.get("10.0.0.1")
+	b, releaseB, _ := c.get("10.0.0.2")
+	if a1 != a2 || a1 == b {
+		t.Errorf("the handlers are not shared by host")
+	}
+	release1()
+	release2()
+	releaseB()
+	if len(c.handlers) != 0 {
+		t.Errorf("%d handlers are kept without connections", len(c.handlers))
+	}
+	c.get("10.0.0.1")
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}; !reflect.DeepEqual(built, want) {
+		t.Errorf("built %q, want %q", built, want)
+	}
+}
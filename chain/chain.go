@@ -4,13 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math"
+	"io"
+	"log/slog"
 	"net"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/wzshiming/bridge"
 	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/internal/expand"
 	"github.com/wzshiming/bridge/internal/scheme"
 	"github.com/wzshiming/bridge/logger"
 )
@@ -36,7 +38,7 @@ func (b *BridgeChain) BridgeChain(ctx context.Context, dialer bridge.Dialer, add
 		return dialer, nil
 	}
 	address := addresses[len(addresses)-1]
-	d := b.multiDial(dialer, strings.Split(address, "|"))
+	d := b.multiDial(ctx, logger.Std, dialer, config.Node{LB: expand.Split(address, "|")})
 
 	addresses = addresses[:len(addresses)-1]
 	if len(addresses) == 0 {
@@ -47,10 +49,15 @@ func (b *BridgeChain) BridgeChain(ctx context.Context, dialer bridge.Dialer, add
 
 // BridgeChainWithConfig is multiple crossing of bridge.
 func (b *BridgeChain) BridgeChainWithConfig(ctx context.Context, dialer bridge.Dialer, addresses ...config.Node) (bridge.Dialer, error) {
+	return b.bridgeChainWithLogger(ctx, logger.Std, dialer, addresses...)
+}
+
+// bridgeChainWithLogger is BridgeChainWithConfig with the logger of the chain.
+func (b *BridgeChain) bridgeChainWithLogger(ctx context.Context, log *slog.Logger, dialer bridge.Dialer, addresses ...config.Node) (bridge.Dialer, error) {
 	if len(addresses) == 0 {
 		return dialer, nil
 	}
-	d, err := b.bridgeChainWithConfig(ctx, dialer, addresses...)
+	d, err := b.bridgeChainWithConfig(ctx, log, dialer, addresses...)
 	if err != nil {
 		return nil, err
 	}
@@ -59,27 +66,51 @@ func (b *BridgeChain) BridgeChainWithConfig(ctx context.Context, dialer bridge.D
 	}
 	return d, nil
 }
-func (b *BridgeChain) bridgeChainWithConfig(ctx context.Context, dialer bridge.Dialer, addresses ...config.Node) (bridge.Dialer, error) {
+func (b *BridgeChain) bridgeChainWithConfig(ctx context.Context, log *slog.Logger, dialer bridge.Dialer, addresses ...config.Node) (bridge.Dialer, error) {
 	if len(addresses) == 0 {
 		return dialer, nil
 	}
 	address := addresses[len(addresses)-1]
 
-	d := b.multiDial(dialer, address.LB)
+	d := b.multiDial(ctx, log, dialer, address)
 
 	addresses = addresses[:len(addresses)-1]
 	if len(addresses) == 0 {
 		return d, nil
 	}
-	return b.bridgeChainWithConfig(ctx, d, addresses...)
+	return b.bridgeChainWithConfig(ctx, log, d, addresses...)
+}
+
+// bridgeChainWithFirst is bridgeChainWithLogger, and also returns the group of the first hop.
+func (b *BridgeChain) bridgeChainWithFirst(ctx context.Context, log *slog.Logger, dialer bridge.Dialer, addresses ...config.Node) (bridge.Dialer, *backoffManager, error) {
+	first := b.multiDial(ctx, log, dialer, addresses[len(addresses)-1])
+	d, err := b.bridgeChainWithConfig(ctx, log, first, addresses[:len(addresses)-1]...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.DialerFunc != nil {
+		d = b.DialerFunc(d)
+	}
+	return d, first, nil
 }
 
-func (b *BridgeChain) multiDial(dialer bridge.Dialer, addresses []string) bridge.Dialer {
-	return newBackoffManager(dialer, b.singleDial, addresses)
+// multiDial returns the dialer of the group, the health checks run until the ctx is done.
+func (b *BridgeChain) multiDial(ctx context.Context, log *slog.Logger, dialer bridge.Dialer, node config.Node) *backoffManager {
+	u := newBackoffManager(dialer, b.singleDial, node)
+	u.logger = log
+	if node.HealthCheck != nil {
+		go u.healthCheck(ctx, *node.HealthCheck)
+	}
+	return u
 }
 
 func (b *BridgeChain) singleDial(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
-	sch, _, ok := scheme.SplitSchemeAddr(address)
+	// The secrets are not kept in the config.
+	expanded, err := expand.Expand(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	sch, _, ok := scheme.SplitSchemeAddr(expanded)
 	if !ok {
 		return nil, fmt.Errorf("unsupported protocol format %q", address)
 	}
@@ -90,7 +121,7 @@ func (b *BridgeChain) singleDial(ctx context.Context, dialer bridge.Dialer, addr
 		}
 		bridger = b.defaultProto
 	}
-	return bridger.Bridge(ctx, dialer, address)
+	return bridger.Bridge(ctx, dialer, expanded)
 }
 
 // Register is register a new bridger for BridgeChain.
@@ -105,151 +136,333 @@ func (b *BridgeChain) RegisterDefault(bridger bridge.Bridger) {
 }
 
 type backoffManager struct {
+	logger    *slog.Logger
 	addresses []string
-	dialers   []bridge.Dialer
+	dialers   []*cachedDialer
 
 	baseDialer bridge.Dialer
 
 	bridgeFunc bridge.BridgeFunc
 
-	backoffCount map[int]uint64
-
+	balancer   balancer
+	priorities []int
+	tier       int
+	retry      retryPolicy
+	// stagger is the delay before the next member joins the race, 0 if not racing.
+	stagger     time.Duration
+	breakers    []breaker
+	active      []int
+	trackActive bool
+	latency     []time.Duration
+	health      []memberHealth
+
+	now func() time.Time
 	mut sync.Mutex
 }
 
-func newBackoffManager(baseDialer bridge.Dialer, bridgeFunc bridge.BridgeFunc, addresses []string) *backoffManager {
+func newBackoffManager(baseDialer bridge.Dialer, bridgeFunc bridge.BridgeFunc, node config.Node) *backoffManager {
 	return &backoffManager{
-		addresses:    addresses,
-		dialers:      make([]bridge.Dialer, len(addresses)),
-		baseDialer:   baseDialer,
-		bridgeFunc:   bridgeFunc,
-		backoffCount: map[int]uint64{},
+		logger:      logger.Std,
+		addresses:   node.LB,
+		dialers:     make([]*cachedDialer, len(node.LB)),
+		baseDialer:  newReachDialer(baseDialer),
+		bridgeFunc:  bridgeFunc,
+		balancer:    newBalancer(node),
+		priorities:  node.Priorities,
+		tier:        minPriority(node.Priorities),
+		retry:       newRetryPolicy(node.Retry, len(node.LB)),
+		stagger:     newStagger(node),
+		breakers:    make([]breaker, len(node.LB)),
+		active:      make([]int, len(node.LB)),
+		trackActive: node.Strategy == config.StrategyLeastActive,
+		latency:     make([]time.Duration, len(node.LB)),
+		health:      make([]memberHealth, len(node.LB)),
+		now:         time.Now,
 	}
 }
 
-func (u *backoffManager) useLeastIndex() int {
-	min := uint64(math.MaxUint64)
+// pick returns the member to use, -1 if none is available.
+func (u *backoffManager) pick(ctx context.Context, target string, skip []bool) int {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	now := u.now()
+	health := u.healthMask()
+	down := make([]bool, len(u.addresses))
+	blocked := make([]bool, len(u.addresses))
+	for i := range u.addresses {
+		down[i] = health[i] || !u.breakers[i].available(now)
+		blocked[i] = skip[i] || down[i]
+	}
+	u.failover(down)
+	u.priorityTier(blocked)
+	index := u.balancer.next(ctx, u, target, blocked)
+	if index < 0 {
+		// The open circuits never refuse the last members left.
+		copy(blocked, skip)
+		u.priorityTier(blocked)
+		index = u.balancer.next(ctx, u, target, blocked)
+	}
+	if index >= 0 {
+		u.breakers[index].acquire()
+	}
+	return index
+}
 
-	var index int
+// available reports whether any member can be used.
+func (u *backoffManager) available() bool {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	now := u.now()
 	for i := range u.addresses {
-		if u.backoffCount[i] < min {
-			min = u.backoffCount[i]
-			index = i
+		if !u.health[i].unhealthy && u.breakers[i].available(now) {
+			return true
 		}
 	}
+	return false
+}
 
-	u.backoffCount[index]++
+// succeeded closes the circuit of the member.
+func (u *backoffManager) succeeded(index int) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if u.breakers[index].success() {
+		u.logger.Info("Circuit breaker", "status", breakerClosed.String(), "previous", u.addresses[index])
+	}
+}
 
-	if min > math.MaxInt32 {
-		for i := range u.backoffCount {
-			u.backoffCount[i] -= math.MaxInt32
-		}
+// done reports the result of the attempt on the member.
+func (u *backoffManager) done(index int, err error) {
+	if err != nil && isUnreached(err) {
+		u.failed(index)
+	} else {
+		u.succeeded(index)
 	}
-	return index
 }
 
-func (u *backoffManager) backoff(index int, count uint64) {
+// report is done, the failure after the caller gave up does not count.
+func (u *backoffManager) report(ctx context.Context, index int, err error) {
+	if err != nil && ctx.Err() != nil {
+		u.release(index)
+		return
+	}
+	u.done(index, err)
+}
+
+// release ends the use of the member without a result, such as the canceled racer.
+func (u *backoffManager) release(index int) {
 	u.mut.Lock()
 	defer u.mut.Unlock()
-	u.backoffCount[index] += count
+	u.breakers[index].release()
 }
 
-func (u *backoffManager) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+// failed counts the failure to the circuit of the member.
+func (u *backoffManager) failed(index int) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	b := &u.breakers[index]
+	if b.failure(u.now()) {
+		u.logger.Warn("Circuit breaker", "status", breakerOpen.String(), "cooldown", b.cooldown, "previous", u.addresses[index])
+	}
+}
+
+// memberDialer returns the cached dialer of the member.
+func (u *backoffManager) memberDialer(ctx context.Context, index int) (*cachedDialer, error) {
 	u.mut.Lock()
-	index := u.useLeastIndex()
 	addr := u.addresses[index]
-	dialer := u.dialers[index]
+	d := u.dialers[index]
 	u.mut.Unlock()
-
-	if dialer == nil {
-		d, err := u.bridgeFunc(ctx, u.baseDialer, addr)
-		if err != nil {
-			logger.Std.Warn("failed dial", "err", err, "previous", addr)
-			u.backoff(index, 16)
-			return nil, err
+	if d != nil {
+		if !isClosed(d.Dialer) {
+			return d, nil
 		}
-		dialer = d
-
-		u.mut.Lock()
-		u.dialers[index] = d
-		u.mut.Unlock()
+		u.discard(index, d, "closed")
 	}
 
-	conn, err := dialer.DialContext(ctx, network, address)
+	dialer, err := u.bridgeFunc(ctx, u.baseDialer, addr)
 	if err != nil {
-		logger.Std.Warn("failed dial target", "err", err, "previous", addr, "target", address)
-		u.backoff(index, 8)
+		u.logger.Warn("failed dial", "err", err, "previous", addr)
 		return nil, err
 	}
 
-	logger.Std.Info("success dial target", "previous", addr, "target", address)
-	return conn, nil
+	d = &cachedDialer{Dialer: dialer}
+	u.mut.Lock()
+	if cur := u.dialers[index]; cur != nil {
+		u.mut.Unlock()
+		// Another dial built it meanwhile, keep that one and close the extra client.
+		closeDialer(d)
+		return cur, nil
+	}
+	u.dialers[index] = d
+	u.mut.Unlock()
+	return d, nil
 }
 
-func (u *backoffManager) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+// handshaker is implemented by the dialers that hold a client, such as the ssh connection.
+type handshaker interface {
+	// Handshake connects the client without dialing through it.
+	Handshake(ctx context.Context) error
+}
+
+// handshake connects the client of the member, or dials its address.
+func (u *backoffManager) handshake(ctx context.Context) error {
 	var errs []error
-	tryTimes := len(u.addresses)/2 + 1
-	for i := 0; i < tryTimes; i++ {
-		conn, err := u.dialContext(ctx, network, address)
-		if err != nil {
-			errs = append(errs, err)
+	skip := u.unhealthy()
+	for i := range u.addresses {
+		if skip[i] {
 			continue
 		}
-		return conn, nil
+		dialer, err := u.memberDialer(ctx, i)
+		if err == nil {
+			if h, ok := dialer.Dialer.(handshaker); ok {
+				err = h.Handshake(ctx)
+			} else {
+				err = u.dialMember(ctx, i)
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
 	}
-	return nil, errors.Join(errs...)
+	return errors.Join(errs...)
 }
 
-func (u *backoffManager) listen(ctx context.Context, network, address string) (net.Listener, error) {
-	u.mut.Lock()
-	index := u.useLeastIndex()
+// dialMember dials the address of the member, the commands are not dialed.
+func (u *backoffManager) dialMember(ctx context.Context, index int) error {
+	expanded, err := expand.Expand(ctx, u.addresses[index])
+	if err != nil {
+		return err
+	}
+	_, addr, ok := scheme.SplitSchemeAddr(expanded)
+	if !ok {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil
+	}
+	conn, err := u.baseDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (u *backoffManager) dialContext(ctx context.Context, network, address string, index int) (net.Conn, error) {
 	addr := u.addresses[index]
-	dialer := u.dialers[index]
-	u.mut.Unlock()
+	ctx, r := withReach(ctx)
+	dialer, err := u.memberDialer(ctx, index)
+	if err != nil {
+		r.finish()
+		return nil, &unreachedError{err}
+	}
 
-	if dialer == nil {
-		d, err := u.bridgeFunc(ctx, u.baseDialer, addr)
-		if err != nil {
-			logger.Std.Warn("failed dial", "err", err, "previous", addr)
-			u.backoff(index, 16)
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, address)
+	failed := r.finish()
+	u.dialerDone(index, dialer, err != nil && failed && !canceled(ctx))
+	if err != nil {
+		if !failed {
+			u.logger.Warn("failed dial target", "err", err, "previous", addr, "target", address)
 			return nil, err
 		}
-		dialer = d
-
+		u.logger.Warn("failed dial", "err", err, "previous", addr, "target", address)
 		u.mut.Lock()
-		u.dialers[index] = d
+		u.observeLatency(index, latencyFailure)
 		u.mut.Unlock()
+		return nil, &unreachedError{err}
 	}
+	u.mut.Lock()
+	u.observeLatency(index, time.Since(start))
+	u.mut.Unlock()
+
+	u.logger.Info("success dial target", "previous", addr, "target", address)
+	conn = &activeConn{Conn: conn, release: u.hold(dialer)}
+	if u.trackActive {
+		conn = u.track(index, conn)
+	}
+	return conn, nil
+}
 
-	l, ok := dialer.(bridge.ListenConfig)
+func (u *backoffManager) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := u.try(ctx, address, func(ctx context.Context, index int) (io.Closer, error) {
+		return u.dialContext(ctx, network, address, index)
+	})
+	var conn net.Conn
+	if err == nil {
+		conn = c.(net.Conn)
+	}
+	// Any error is the failure to reach the member of the next hop.
+	return reachDial(ctx)(conn, err)
+}
+
+func (u *backoffManager) listen(ctx context.Context, network, address string, index int) (net.Listener, error) {
+	addr := u.addresses[index]
+	ctx, r := withReach(ctx)
+	dialer, err := u.memberDialer(ctx, index)
+	if err != nil {
+		r.finish()
+		return nil, &unreachedError{err}
+	}
+
+	l, ok := dialer.Dialer.(bridge.ListenConfig)
 	if !ok || l == nil {
-		err := fmt.Errorf("the previous proxy %T could not listen", dialer)
-		logger.Std.Warn("failed listen", "err", err, "previous", addr)
-		u.backoff(index, 8)
-		return nil, err
+		r.finish()
+		err := fmt.Errorf("the previous proxy %T could not listen", dialer.Dialer)
+		u.logger.Warn("failed listen", "err", err, "previous", addr)
+		return nil, &unreachedError{err}
 	}
 
 	listener, err := l.Listen(ctx, network, address)
+	failed := r.finish()
+	u.dialerDone(index, dialer, err != nil && failed && !canceled(ctx))
 	if err != nil {
-		logger.Std.Warn("failed listen target", "err", err, "previous", addr, "target", address)
-		u.backoff(index, 8)
-		return nil, err
+		if !failed {
+			u.logger.Warn("failed listen target", "err", err, "previous", addr, "target", address)
+			return nil, err
+		}
+		u.logger.Warn("failed listen", "err", err, "previous", addr, "target", address)
+		return nil, &unreachedError{err}
 	}
 
-	logger.Std.Info("success listen target", "previous", addr, "target", address)
-	return listener, nil
+	u.logger.Info("success listen target", "previous", addr, "target", address)
+	return &activeListener{Listener: listener, release: u.hold(dialer)}, nil
 }
 
 func (u *backoffManager) Listen(ctx context.Context, network, address string) (net.Listener, error) {
-	var errs []error
-	tryTimes := len(u.addresses)/2 + 1
-	for i := 0; i < tryTimes; i++ {
-		listener, err := u.listen(ctx, network, address)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		return listener, nil
+	c, err := u.try(ctx, address, func(ctx context.Context, index int) (io.Closer, error) {
+		return u.listen(ctx, network, address, index)
+	})
+	if err != nil {
+		unreached(ctx)
+		return nil, err
 	}
-	return nil, errors.Join(errs...)
+	return c.(net.Listener), nil
+}
+
+var errNoMember = errors.New("no member is available")
+
+// track counts the connection as active on the member until it is closed.
+func (u *backoffManager) track(index int, conn net.Conn) net.Conn {
+	u.mut.Lock()
+	u.active[index]++
+	u.mut.Unlock()
+	return &activeConn{
+		Conn: conn,
+		release: func() {
+			u.mut.Lock()
+			u.active[index]--
+			u.mut.Unlock()
+		},
+	}
+}
+
+type activeConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *activeConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
 }
@@ -0,0 +1,45 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/protocols/local"
+)
+
+func TestBridgeChainLogger(t *testing.T) {
+	b := NewBridgeChain()
+	b.DialerFunc = nil
+	b.Register("fail", bridge.BridgeFunc(func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		return bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("refused")
+		}), nil
+	}))
+
+	var buf bytes.Buffer
+	log := WithChain(slog.New(slog.NewJSONHandler(&buf, nil)), config.Chain{Name: "web"})
+	d, err := b.bridgeChainWithLogger(context.Background(), log, local.LOCAL, config.Node{LB: []string{"fail://a:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < breakerThreshold; i++ {
+		d.DialContext(context.Background(), "tcp", "x:1")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < breakerThreshold {
+		t.Fatalf("got %d records, want at least %d", len(lines), breakerThreshold)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"chain_name":"web"`) {
+			t.Errorf("the record has no chain name: %s", line)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package chain
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// connTracker tracks the active connections of a bridge.
+type connTracker struct {
+	mut   sync.Mutex
+	conns map[io.Closer]struct{}
+}
+
+// track adds the connection, and returns the function to remove it once it is finished.
+func (t *connTracker) track(c io.Closer) func() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.conns == nil {
+		t.conns = map[io.Closer]struct{}{}
+	}
+	t.conns[c] = struct{}{}
+	return func() {
+		t.mut.Lock()
+		defer t.mut.Unlock()
+		delete(t.conns, c)
+	}
+}
+
+func (t *connTracker) active() int {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return len(t.conns)
+}
+
+// closeAll closes the active connections, and returns the number of them.
+func (t *connTracker) closeAll() int {
+	t.mut.Lock()
+	conns := make([]io.Closer, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mut.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+	return len(conns)
+}
+
+// ActiveConns returns the number of the active connections.
+func (b *Bridge) ActiveConns() int {
+	return b.conns.active()
+}
+
+// Drain waits for the active connections to finish up to the timeout, and then closes the rest.
+func (b *Bridge) Drain(timeout time.Duration) (drained, killed int) {
+	active := b.conns.active()
+	if active == 0 {
+		return 0, 0
+	}
+
+	ticker := time.NewTicker(time.Second / 10)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if b.conns.active() == 0 {
+				return active, 0
+			}
+		case <-deadline.C:
+			killed = b.conns.closeAll()
+			return active - killed, killed
+		}
+	}
+}
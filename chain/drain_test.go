@@ -0,0 +1,137 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	_ "github.com/wzshiming/anyproxy/proxies/socks5"
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/logger"
+	"github.com/wzshiming/socks5"
+)
+
+func TestDrain(t *testing.T) {
+	b := NewBridge(logger.Std, false)
+	if drained, killed := b.Drain(time.Second); drained != 0 || killed != 0 {
+		t.Fatalf("Drain() = %d, %d, want 0, 0", drained, killed)
+	}
+
+	finished, _ := net.Pipe()
+	untrack := b.conns.track(finished)
+	stuck, peer := net.Pipe()
+	b.conns.track(stuck)
+	if got := b.ActiveConns(); got != 2 {
+		t.Fatalf("ActiveConns() = %d, want 2", got)
+	}
+
+	go func() {
+		time.Sleep(time.Second / 5)
+		untrack()
+	}()
+	drained, killed := b.Drain(time.Second)
+	if drained != 1 || killed != 1 {
+		t.Fatalf("Drain() = %d, %d, want 1, 1", drained, killed)
+	}
+
+	// The stuck connection is closed.
+	_, err := peer.Read(make([]byte, 1))
+	if err == nil {
+		t.Fatal("the connection is not closed")
+	}
+}
+
+func TestStepOutlivesCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dialing := make(chan struct{})
+	dialer := bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		close(dialing)
+		time.Sleep(time.Second / 10)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		conn, _ := net.Pipe()
+		return conn, nil
+	})
+	raw, peer := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- step(ctx, dialer, raw, []string{"tcp://x:1"})
+	}()
+
+	// The connection accepted before the stop is still dialed.
+	<-dialing
+	cancel()
+	peer.Close()
+	if err := <-done; errors.Is(err, context.Canceled) {
+		t.Fatalf("step() = %v, want the dial not canceled", err)
+	}
+}
+
+func TestDrainProxyMode(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBridge(logger.Std, false)
+	ready := make(chan error, 1)
+	b.NotifyReady(func(err error) {
+		ready <- err
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Bridge(ctx, []string{"socks5://" + addr}, []string{"-"})
+	}()
+	if err := <-ready; err != nil {
+		t.Fatal(err)
+	}
+
+	dialer, err := socks5.NewDialer("socks5://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The tunnel outlives the stop of the chain until it is drained.
+	cancel()
+	<-done
+	buf := make([]byte, 4)
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("the tunnel is closed with the chain: %v", err)
+	}
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("the tunnel is closed with the chain: %v", err)
+	}
+	if drained, killed := b.Drain(time.Second / 5); drained != 0 || killed != 1 {
+		t.Errorf("Drain() = %d, %d, want 0, 1", drained, killed)
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/internal/route"
+	"github.com/wzshiming/bridge/logger"
 	"github.com/wzshiming/bridge/protocols/local"
 	"github.com/wzshiming/hostmatcher"
 )
@@ -14,33 +18,56 @@ import (
 var (
 	NoProxy   hostmatcher.Matcher
 	OnlyProxy hostmatcher.Matcher
+
+	watchOnce sync.Once
 )
 
 func init() {
-	noProxy, ok := os.LookupEnv("no_proxy")
-	if !ok {
-		noProxy, ok = os.LookupEnv("NO_PROXY")
-	}
-	if ok && noProxy != "" {
-		list := strings.Split(noProxy, ",")
-		if len(list) != 0 {
-			NoProxy = hostmatcher.NewMatcher(list)
+	NoProxy = envMatcher("no_proxy", "NO_PROXY")
+	OnlyProxy = envMatcher("only_proxy", "ONLY_PROXY")
+}
+
+// watchEnv watches the list: sources of NoProxy and OnlyProxy on the first use.
+func watchEnv() {
+	watchOnce.Do(func() {
+		for _, m := range []hostmatcher.Matcher{NoProxy, OnlyProxy} {
+			if m, ok := m.(*route.HostMatcher); ok {
+				route.WatchLists(context.Background(), logger.Std, m.Lists())
+			}
 		}
-	}
+	})
+}
 
-	onlyProxy, ok := os.LookupEnv("only_proxy")
-	if !ok {
-		onlyProxy, ok = os.LookupEnv("ONLY_PROXY")
-	}
-	if ok && onlyProxy != "" {
-		list := strings.Split(onlyProxy, ",")
-		if len(list) != 0 {
-			OnlyProxy = hostmatcher.NewMatcher(list)
+// envMatcher returns the matcher of the comma-separated hosts of the environment variable.
+func envMatcher(keys ...string) hostmatcher.Matcher {
+	for _, key := range keys {
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if value == "" {
+			return nil
+		}
+		hosts := strings.Split(value, ",")
+		for i, host := range hosts {
+			if path, ok := route.IsList(host); ok {
+				if abs, err := filepath.Abs(path); err == nil {
+					hosts[i] = route.ListPrefix + abs
+				}
+			}
+		}
+		m, err := route.NewHostMatcher(hosts)
+		if err != nil {
+			logger.Std.Error("Load the hosts", "env", key, "err", err)
+			return nil
 		}
+		return m
 	}
+	return nil
 }
 
 func NewEnvDialer(dialer bridge.Dialer) bridge.Dialer {
+	watchEnv()
 	if OnlyProxy == nil && NoProxy == nil {
 		return dialer
 	}
@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/protocols/local"
+)
+
+// chainFailover dials through the first of the alternative hops whose first hop is available.
+type chainFailover struct {
+	logger  *slog.Logger
+	hops    []string
+	dialers []bridge.Dialer
+	// firsts are the groups of the first hops, nil if it dials directly.
+	firsts []*backoffManager
+
+	mut    sync.Mutex
+	active int
+}
+
+// newChainFailover builds the hops of the proxy and of the backups.
+func (b *Bridge) newChainFailover(ctx context.Context, chain config.Chain) (*chainFailover, error) {
+	c := &chainFailover{
+		logger: b.logger,
+	}
+	for _, hops := range append([][]config.Node{chain.Proxy[1:]}, chain.Backups...) {
+		var dialer bridge.Dialer = local.LOCAL
+		var first *backoffManager
+		if len(hops) != 0 {
+			d, f, err := b.chain.bridgeChainWithFirst(ctx, b.logger, local.LOCAL, withRetry(hops, chain.Retry)...)
+			if err != nil {
+				return nil, err
+			}
+			dialer, first = d, f
+		}
+		c.hops = append(c.hops, showHops(hops))
+		c.dialers = append(c.dialers, dialer)
+		c.firsts = append(c.firsts, first)
+	}
+	return c, nil
+}
+
+// pick returns the preferred hops whose first hop is available, the active ones if none is.
+func (c *chainFailover) pick() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for i, first := range c.firsts {
+		if first != nil && !first.available() {
+			continue
+		}
+		if i != c.active {
+			if i > c.active {
+				c.logger.Warn("Switch chain", "active", c.hops[i], "previous", c.hops[c.active])
+			} else {
+				c.logger.Info("Switch chain", "active", c.hops[i], "previous", c.hops[c.active])
+			}
+			c.active = i
+		}
+		return i
+	}
+	return c.active
+}
+
+func (c *chainFailover) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return c.dialers[c.pick()].DialContext(ctx, network, address)
+}
+
+func showHops(hops []config.Node) string {
+	if len(hops) == 0 {
+		return "LOCAL"
+	}
+	addresses := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		addresses = append(addresses, strings.Join(hop.LB, "|"))
+	}
+	return strings.Join(removeUserInfo(addresses), " <- ")
+}
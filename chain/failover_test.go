@@ -0,0 +1,58 @@
+package chain
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/logger"
+)
+
+func TestChainFailover(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	f := &fakeMembers{fail: map[string]bool{"corp": true}}
+	corp := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"corp"}})
+	corp.now = func() time.Time { return now }
+	direct := bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		f.mut.Lock()
+		defer f.mut.Unlock()
+		f.dials = append(f.dials, "direct")
+		c, _ := net.Pipe()
+		return c, nil
+	})
+	c := &chainFailover{
+		logger:  logger.Std,
+		hops:    []string{"corp", "LOCAL"},
+		dialers: []bridge.Dialer{corp, direct},
+		firsts:  []*backoffManager{corp, nil},
+	}
+
+	// The preferred chain is used until its first hop keeps failing.
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := c.DialContext(ctx, "tcp", "x:1"); err == nil {
+			t.Fatalf("dial through the failing chain succeeded")
+		}
+	}
+	dialN(t, ctx, c, "x:1")
+	if c.active != 1 {
+		t.Errorf("active = %d, want 1", c.active)
+	}
+
+	// It switches back once the first hop recovers.
+	f.mut.Lock()
+	f.fail["corp"] = false
+	f.mut.Unlock()
+	now = now.Add(breakerCooldown)
+	dialN(t, ctx, c, "x:1")
+	if c.active != 0 {
+		t.Errorf("active = %d, want 0", c.active)
+	}
+	if got, want := f.picked(), []string{"corp", "corp", "corp", "direct", "corp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package chain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/internal/scheme"
+)
+
+// The defaults of config.HealthCheck.
+const (
+	healthInterval = 10 * time.Second
+	healthTimeout  = 5 * time.Second
+	healthRise     = 2
+	healthFall     = 3
+)
+
+// memberHealth is the health state of a member.
+type memberHealth struct {
+	unhealthy bool
+	successes int
+	failures  int
+}
+
+// healthCheck probes the members at the interval until the ctx is done.
+func (u *backoffManager) healthCheck(ctx context.Context, hc config.HealthCheck) {
+	if hc.Interval == 0 {
+		hc.Interval = healthInterval
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = healthTimeout
+	}
+	if hc.Rise == 0 {
+		hc.Rise = healthRise
+	}
+	if hc.Fall == 0 {
+		hc.Fall = healthFall
+	}
+
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for i := range u.addresses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := u.probe(ctx, i, hc)
+				if ctx.Err() != nil {
+					return
+				}
+				u.reportHealth(i, err, hc)
+			}(i)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe dials the target through the member.
+func (u *backoffManager) probe(ctx context.Context, index int, hc config.HealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+	ctx, r := withReach(ctx)
+	dialer, err := u.memberDialer(ctx, index)
+	if err != nil {
+		return err
+	}
+	network, address, _ := scheme.SplitSchemeAddr(hc.Target)
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, address)
+	u.dialerDone(index, dialer, r.finish() && err != nil)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	u.mut.Lock()
+	u.observeLatency(index, time.Since(start))
+	u.mut.Unlock()
+	return nil
+}
+
+func (u *backoffManager) reportHealth(index int, err error, hc config.HealthCheck) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	h := &u.health[index]
+	addr := u.addresses[index]
+	if err == nil {
+		h.successes++
+		h.failures = 0
+		if h.unhealthy && h.successes >= hc.Rise {
+			h.unhealthy = false
+			u.logger.Info("Health check", "status", "healthy", "previous", addr, "target", hc.Target)
+		}
+		return
+	}
+	h.failures++
+	h.successes = 0
+	if !h.unhealthy && h.failures >= hc.Fall {
+		h.unhealthy = true
+		u.logger.Warn("Health check", "status", "unhealthy", "err", err, "previous", addr, "target", hc.Target)
+		return
+	}
+	u.logger.Debug("Health check", "status", "failed", "err", err, "previous", addr, "target", hc.Target)
+}
+
+// unhealthy returns the members that are out of rotation.
+func (u *backoffManager) unhealthy() []bool {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	return u.healthMask()
+}
+
+// healthMask is unhealthy with the lock held.
+func (u *backoffManager) healthMask() []bool {
+	skip := make([]bool, len(u.addresses))
+	all := true
+	for i, h := range u.health {
+		skip[i] = h.unhealthy
+		all = all && h.unhealthy
+	}
+	if all {
+		return make([]bool, len(u.addresses))
+	}
+	return skip
+}
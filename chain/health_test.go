@@ -0,0 +1,64 @@
+package chain
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+func TestHealthCheck(t *testing.T) {
+	f := &fakeMembers{fail: map[string]bool{"a": true}}
+	u := newBackoffManager(nil, f.bridge, config.Node{
+		LB:       []string{"a", "b"},
+		Strategy: config.StrategyRoundRobin,
+	})
+	hc := config.HealthCheck{
+		Target:   "x:1",
+		Interval: 10 * time.Millisecond,
+		Rise:     2,
+		Fall:     2,
+	}
+
+	// check runs the health checks until the health is as wanted.
+	check := func(want []bool) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			u.healthCheck(ctx, hc)
+		}()
+		defer func() {
+			cancel()
+			<-done
+			f.picked()
+		}()
+		deadline := time.Now().Add(time.Second)
+		for !reflect.DeepEqual(u.unhealthy(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("unhealthy() = %v, want %v", u.unhealthy(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	check([]bool{true, false})
+	dialN(t, context.Background(), u, "x:1", "x:1")
+	if got, want := f.picked(), []string{"b", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+
+	f.mut.Lock()
+	f.fail["a"] = false
+	f.mut.Unlock()
+	check([]bool{false, false})
+
+	// All members are unhealthy, the health is ignored.
+	u.health = []memberHealth{{unhealthy: true}, {unhealthy: true}}
+	if got, want := u.unhealthy(), []bool{false, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unhealthy() = %v, want %v", got, want)
+	}
+}
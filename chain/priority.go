@@ -0,0 +1,56 @@
+package chain
+
+import (
+	"slices"
+)
+
+// priorityTier blocks the members outside the best priority of the ones not blocked.
+func (u *backoffManager) priorityTier(blocked []bool) {
+	best := u.bestPriority(blocked)
+	if best < 0 {
+		return
+	}
+	for i, p := range u.priorities {
+		if p != best {
+			blocked[i] = true
+		}
+	}
+}
+
+// failover logs the switch of the priority in use.
+func (u *backoffManager) failover(down []bool) {
+	best := u.bestPriority(down)
+	if best < 0 || best == u.tier {
+		return
+	}
+	var members []string
+	for i, p := range u.priorities {
+		if p == best {
+			members = append(members, u.addresses[i])
+		}
+	}
+	if best > u.tier {
+		u.logger.Warn("Failover", "priority", best, "from", u.tier, "members", members)
+	} else {
+		u.logger.Info("Failover", "priority", best, "from", u.tier, "members", members)
+	}
+	u.tier = best
+}
+
+// bestPriority returns the best priority of the members not blocked, -1 if there is none.
+func (u *backoffManager) bestPriority(blocked []bool) int {
+	best := -1
+	for i, p := range u.priorities {
+		if !blocked[i] && (best < 0 || p < best) {
+			best = p
+		}
+	}
+	return best
+}
+
+func minPriority(priorities []int) int {
+	if len(priorities) == 0 {
+		return 0
+	}
+	return slices.Min(priorities)
+}
@@ -0,0 +1,69 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+func TestPriorityFailover(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	f := &fakeMembers{fail: map[string]bool{"a": true}}
+	u := newBackoffManager(nil, f.bridge, config.Node{
+		LB:         []string{"a", "b", "c"},
+		Priorities: []int{0, 1, 1},
+	})
+	u.now = func() time.Time { return now }
+
+	// The primary is tried first until its circuit is open, then the secondaries are balanced.
+	dialN(t, ctx, u, "x:1", "x:1", "x:1", "x:1", "x:1")
+	if got, want := f.picked(), []string{"a", "b", "a", "b", "a", "b", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+	if u.tier != 1 {
+		t.Errorf("tier = %d, want 1", u.tier)
+	}
+
+	// The primary is used again once it recovers.
+	f.mut.Lock()
+	f.fail["a"] = false
+	f.mut.Unlock()
+	now = now.Add(breakerCooldown)
+	dialN(t, ctx, u, "x:1", "x:1")
+	if got, want := f.picked(), []string{"a", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+	if u.tier != 0 {
+		t.Errorf("tier = %d, want 0", u.tier)
+	}
+}
+
+func TestPriorityFailoverLog(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeMembers{fail: map[string]bool{"a": true}}
+	u := newBackoffManager(nil, f.bridge, config.Node{
+		LB:         []string{"a", "b"},
+		Priorities: []int{0, 1},
+	})
+	var buf bytes.Buffer
+	u.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	// The primary skipped by the retry of a connection is not a failover.
+	dialN(t, ctx, u, "x:1")
+	if strings.Contains(buf.String(), "Failover") {
+		t.Errorf("logged the failover for the retry: %s", buf.String())
+	}
+
+	// The open circuit of the primary is.
+	dialN(t, ctx, u, "x:1", "x:1", "x:1")
+	if got := strings.Count(buf.String(), "Failover"); got != 1 {
+		t.Errorf("logged the failover %d times, want 1: %s", got, buf.String())
+	}
+}
@@ -0,0 +1,106 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+// fakeHandshaker is a dialer whose client is connected by Handshake.
+type fakeHandshaker struct {
+	block  bool
+	dialed int
+}
+
+func (h *fakeHandshaker) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	h.dialed++
+	return nil, errors.New("refused")
+}
+
+func (h *fakeHandshaker) Handshake(ctx context.Context) error {
+	if h.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+// fakeDialer is a dialer that connects nothing until it is dialed through.
+type fakeDialer struct{}
+
+func (fakeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, errors.New("refused")
+}
+
+func TestProbeAddress(t *testing.T) {
+	first := func(address string) *dialState {
+		return &dialState{firsts: []*backoffManager{newBackoffManager(nil, func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+			return fakeDialer{}, nil
+		}, config.Node{LB: []string{address}})}}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := first("socks5://" + l.Addr().String()).probe(context.Background()); err != nil {
+		t.Errorf("probe() of the listening hop = %v", err)
+	}
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := closed.Addr().String()
+	closed.Close()
+	if err := first("socks5://" + addr).probe(context.Background()); err == nil {
+		t.Errorf("probe() of the closed hop = nil, want an error")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	first := func(h *fakeHandshaker) *backoffManager {
+		return newBackoffManager(nil, func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+			return h, nil
+		}, config.Node{LB: []string{"a"}})
+	}
+
+	direct := &dialState{}
+	if err := direct.probe(context.Background()); err != nil {
+		t.Errorf("probe() of the direct dial = %v", err)
+	}
+
+	h := &fakeHandshaker{}
+	s := &dialState{firsts: []*backoffManager{first(h)}}
+	if err := s.probe(context.Background()); err != nil {
+		t.Errorf("probe() = %v", err)
+	}
+	if h.dialed != 0 {
+		t.Errorf("probe() dialed %d times through the first hop, want 0", h.dialed)
+	}
+
+	blocked := &dialState{firsts: []*backoffManager{first(&fakeHandshaker{block: true})}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := blocked.probe(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("probe() of the blackholed hop = %v, want the deadline", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("probe() took %s", d)
+	}
+
+	// It is enough that one of the backups can be reached.
+	failover := &dialState{firsts: []*backoffManager{first(&fakeHandshaker{block: true}), first(&fakeHandshaker{})}}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := failover.probe(ctx); err != nil {
+		t.Errorf("probe() with a backup = %v", err)
+	}
+}
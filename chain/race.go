@@ -0,0 +1,124 @@
+package chain
+
+import (
+	"context"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+// raceStagger is the default delay before the next member joins the race, as in happy eyeballs.
+const raceStagger = 250 * time.Millisecond
+
+func newStagger(node config.Node) time.Duration {
+	if !node.Race {
+		return 0
+	}
+	if node.Stagger != 0 {
+		return node.Stagger
+	}
+	return raceStagger
+}
+
+// race runs the attempt on the picked members in parallel, the first success wins.
+func (u *backoffManager) race(ctx context.Context, target string, attempt func(ctx context.Context, index int) (io.Closer, error)) (io.Closer, error) {
+	p := u.retry
+	type result struct {
+		racer int
+		index int
+		c     io.Closer
+		err   error
+	}
+	results := make(chan result)
+
+	var deadline <-chan time.Time
+	if p.deadline > 0 {
+		timer := time.NewTimer(p.deadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	stagger := time.NewTimer(u.stagger)
+	stagger.Stop()
+	defer stagger.Stop()
+
+	var errs []error
+	var cancels []context.CancelFunc
+	skip := u.unhealthy()
+	pending := 0
+	stopped := false
+	start := func() bool {
+		if stopped || len(cancels) >= p.attempts {
+			return false
+		}
+		index := u.pick(ctx, target, skip)
+		if index < 0 {
+			return false
+		}
+		skip[index] = true
+		racer := len(cancels)
+		ctx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		pending++
+		go func() {
+			c, err := withTimeout(ctx, p.timeout, func(ctx context.Context) (io.Closer, error) {
+				return attempt(ctx, index)
+			})
+			results <- result{racer, index, c, err}
+		}()
+		return true
+	}
+	// abort cancels the racers except the winner, and closes the late successes.
+	abort := func(winner int) {
+		for i, cancel := range cancels {
+			if i != winner {
+				cancel()
+			}
+		}
+		go func(pending int) {
+			for ; pending > 0; pending-- {
+				r := <-results
+				if r.err != nil {
+					u.release(r.index)
+					continue
+				}
+				u.done(r.index, nil)
+				r.c.Close()
+			}
+		}(pending)
+	}
+
+	next := true
+	for {
+		if next && start() {
+			stagger.Reset(u.stagger)
+		}
+		next = false
+		if pending == 0 {
+			break
+		}
+		select {
+		case r := <-results:
+			pending--
+			u.report(ctx, r.index, r.err)
+			if r.err == nil {
+				abort(r.racer)
+				// The ctx of the winner is canceled once its connection is closed.
+				return onClose(r.c, cancels[r.racer]), nil
+			}
+			cancels[r.racer]()
+			errs = append(errs, r.err)
+			if ctx.Err() != nil || !slices.Contains(p.on, errorKind(r.err)) {
+				stopped = true
+			}
+			next = true
+		case <-stagger.C:
+			next = true
+		case <-deadline:
+			abort(-1)
+			return nil, joinErrors(append(errs, errDeadline(p.deadline)))
+		}
+	}
+	return nil, joinErrors(errs)
+}
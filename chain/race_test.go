@@ -0,0 +1,154 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+// closeConn records whether it is closed.
+type closeConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *closeConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+func TestRace(t *testing.T) {
+	ctx := context.Background()
+	canceled := make(chan struct{})
+	late := &closeConn{}
+	late.Conn, _ = net.Pipe()
+	build := func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		return bridge.DialFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+			switch address {
+			case "blackhole":
+				<-ctx.Done()
+				close(canceled)
+				return nil, ctx.Err()
+			case "late":
+				time.Sleep(50 * time.Millisecond)
+				return late, nil
+			case "refused":
+				return nil, errors.New("refused")
+			}
+			c, _ := net.Pipe()
+			return &closeConn{Conn: c}, nil
+		}), nil
+	}
+	tests := []struct {
+		name    string
+		members []string
+		stagger time.Duration
+	}{
+		{
+			name:    "blackhole",
+			members: []string{"blackhole", "ok"},
+			stagger: 10 * time.Millisecond,
+		},
+		{
+			name:    "late",
+			members: []string{"late", "ok"},
+			stagger: 10 * time.Millisecond,
+		},
+		{
+			name:    "failure starts the next",
+			members: []string{"refused", "ok"},
+			stagger: time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newBackoffManager(nil, build, config.Node{
+				LB:      tt.members,
+				Race:    true,
+				Stagger: tt.stagger,
+				Retry:   &config.Retry{Attempts: 2},
+			})
+			start := time.Now()
+			conn, err := u.DialContext(ctx, "tcp", "x:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conn == late {
+				t.Errorf("got the late connection")
+			}
+			if d := time.Since(start); d > 40*time.Millisecond {
+				t.Errorf("took %s", d)
+			}
+		})
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("the blackholed dial is not canceled")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !late.closed.Load() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the late connection is not closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRaceAbort(t *testing.T) {
+	ctx := context.Background()
+	var winner context.Context
+	build := func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		return bridge.DialFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+			if address == "blackhole" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			winner = ctx
+			c, _ := net.Pipe()
+			return c, nil
+		}), nil
+	}
+	u := newBackoffManager(nil, build, config.Node{
+		LB:      []string{"blackhole", "ok"},
+		Race:    true,
+		Stagger: 10 * time.Millisecond,
+		Retry:   &config.Retry{Attempts: 2},
+	})
+	// The blackhole holds the trial of its half-open circuit.
+	u.breakers[0] = breaker{state: breakerOpen, cooldown: breakerCooldown}
+
+	conn, err := u.DialContext(ctx, "tcp", "x:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if winner.Err() != nil {
+		t.Errorf("the ctx of the winner is canceled before it is closed")
+	}
+	conn.Close()
+	if winner.Err() == nil {
+		t.Errorf("the ctx of the winner is not canceled after it is closed")
+	}
+
+	// The canceled trial is released.
+	deadline := time.Now().Add(time.Second)
+	for {
+		u.mut.Lock()
+		trial := u.breakers[0].trial
+		u.mut.Unlock()
+		if !trial {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the trial of the canceled racer is not released")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,129 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/protocols/local"
+)
+
+// reach records whether the member of an attempt could not be reached.
+type reach struct {
+	mut    sync.Mutex
+	failed bool
+	done   bool
+}
+
+type reachKey struct{}
+
+// withReach returns the ctx that records the reach of the member of the attempt.
+func withReach(ctx context.Context) (context.Context, *reach) {
+	r := &reach{}
+	return context.WithValue(ctx, reachKey{}, r), r
+}
+
+// unreached marks the member of the attempt of the ctx as not reached.
+func unreached(ctx context.Context) {
+	r, _ := ctx.Value(reachKey{}).(*reach)
+	r.unreached()
+}
+
+func (r *reach) unreached() {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if !r.done {
+		r.failed = true
+	}
+}
+
+// finish ends the attempt, and reports whether the member could not be reached.
+func (r *reach) finish() bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.done = true
+	return r.failed
+}
+
+// unreachedError is the error of an attempt that could not reach the member.
+type unreachedError struct {
+	err error
+}
+
+func (e *unreachedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unreachedError) Unwrap() error {
+	return e.err
+}
+
+func isUnreached(err error) bool {
+	var e *unreachedError
+	return errors.As(err, &e)
+}
+
+// newReachDialer returns the dialer that marks the member as not reached on failure.
+func newReachDialer(dialer bridge.Dialer) bridge.Dialer {
+	switch d := dialer.(type) {
+	case nil:
+		return &reachLocal{Local: local.LOCAL}
+	case *local.Local:
+		return &reachLocal{Local: d}
+	}
+	return dialer
+}
+
+type reachLocal struct {
+	*local.Local
+}
+
+func (l *reachLocal) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return reachDial(ctx)(l.Local.DialContext(ctx, network, address))
+}
+
+func (l *reachLocal) CommandDialContext(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	return reachDial(ctx)(l.Local.CommandDialContext(ctx, name, args...))
+}
+
+// reachDial records the result of dialing the member.
+func reachDial(ctx context.Context) func(net.Conn, error) (net.Conn, error) {
+	r, _ := ctx.Value(reachKey{}).(*reach)
+	return func(conn net.Conn, err error) (net.Conn, error) {
+		if r == nil {
+			return conn, err
+		}
+		if err != nil {
+			r.unreached()
+			return nil, err
+		}
+		return &reachConn{Conn: conn, reach: r}, nil
+	}
+}
+
+// reachConn is the connection to the member during the attempt.
+type reachConn struct {
+	net.Conn
+	reach *reach
+}
+
+func (c *reachConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.reach.unreached()
+	}
+	return n, err
+}
+
+func (c *reachConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		c.reach.unreached()
+	}
+	return n, err
+}
@@ -0,0 +1,98 @@
+package chain
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+func TestReachDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		address string
+		read    bool
+		want    bool
+	}{
+		{
+			name:    "reached",
+			address: listener.Addr().String(),
+		},
+		{
+			name:    "refused",
+			address: closed.Addr().String(),
+			want:    true,
+		},
+		{
+			name:    "failed handshake",
+			address: listener.Addr().String(),
+			read:    true,
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, r := withReach(context.Background())
+			conn, err := newReachDialer(nil).DialContext(ctx, "tcp", tt.address)
+			if err == nil {
+				if tt.read {
+					conn.Read(make([]byte, 1))
+				}
+				defer conn.Close()
+			}
+			if got := r.finish(); got != tt.want {
+				t.Errorf("finish() = %v, want %v", got, tt.want)
+			}
+			if conn != nil {
+				// The errors after the attempt do not count.
+				conn.Read(make([]byte, 1))
+				if r.failed != tt.want {
+					t.Errorf("failed = %v after the attempt, want %v", r.failed, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReachPreviousHop(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeMembers{dead: map[string]bool{"b": true}}
+	hop := newBackoffManager(nil, f.bridge, config.Node{LB: []string{"a"}})
+	next := newBackoffManager(hop, func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		return bridge.DialFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		}), nil
+	}, config.Node{LB: []string{"b"}})
+
+	// The previous hop could not dial the member, it is not reached.
+	_, err := next.DialContext(ctx, "tcp", "x:1")
+	if !isUnreached(err) {
+		t.Errorf("DialContext() error = %v, want not reached", err)
+	}
+	// The previous hop reached its own member.
+	if hop.breakers[0].failures != 0 {
+		t.Errorf("failures of the previous hop = %d, want 0", hop.breakers[0].failures)
+	}
+}
@@ -0,0 +1,212 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+// retryPolicy is the config.Retry with the defaults.
+type retryPolicy struct {
+	attempts int
+	timeout  time.Duration
+	deadline time.Duration
+	backoff  time.Duration
+	on       []string
+}
+
+func newRetryPolicy(r *config.Retry, members int) retryPolicy {
+	p := retryPolicy{
+		attempts: members/2 + 1,
+	}
+	if r != nil {
+		if r.Attempts != 0 {
+			p.attempts = r.Attempts
+		}
+		p.timeout = r.Timeout
+		p.deadline = r.Deadline
+		p.backoff = r.Backoff
+		p.on = r.On
+	}
+	if len(p.on) == 0 {
+		for _, on := range config.RetryOns {
+			if on != config.RetryOnAuth {
+				p.on = append(p.on, on)
+			}
+		}
+	}
+	return p
+}
+
+// withRetry sets the retry policy of the chain on the nodes without one.
+func withRetry(nodes []config.Node, retry *config.Retry) []config.Node {
+	if retry == nil {
+		return nodes
+	}
+	out := make([]config.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Retry == nil {
+			node.Retry = retry
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// try runs the attempt on the picked members by the retry policy until one succeeds.
+func (u *backoffManager) try(ctx context.Context, target string, attempt func(ctx context.Context, index int) (io.Closer, error)) (io.Closer, error) {
+	p := u.retry
+	var deadline time.Time
+	if p.deadline > 0 {
+		deadline = time.Now().Add(p.deadline)
+	}
+	if u.stagger > 0 {
+		return u.race(ctx, target, attempt)
+	}
+	var errs []error
+	health := u.unhealthy()
+	skip := slices.Clone(health)
+	backoff := p.backoff
+	for i := 0; i < p.attempts; i++ {
+		if i != 0 && backoff > 0 {
+			if !deadline.IsZero() && time.Until(deadline) < backoff {
+				errs = append(errs, errDeadline(p.deadline))
+				break
+			}
+			err := sleep(ctx, backoff)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			backoff *= 2
+		}
+
+		index := u.pick(ctx, target, skip)
+		if index < 0 && len(errs) != 0 {
+			copy(skip, health)
+			index = u.pick(ctx, target, skip)
+		}
+		if index < 0 {
+			break
+		}
+
+		timeout := p.timeout
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				errs = append(errs, errDeadline(p.deadline))
+				break
+			}
+			if timeout == 0 || left < timeout {
+				timeout = left
+			}
+		}
+		c, err := withTimeout(ctx, timeout, func(ctx context.Context) (io.Closer, error) {
+			return attempt(ctx, index)
+		})
+		u.report(ctx, index, err)
+		if err == nil {
+			return c, nil
+		}
+		errs = append(errs, err)
+		skip[index] = true
+		if ctx.Err() != nil || !slices.Contains(p.on, errorKind(err)) {
+			break
+		}
+	}
+	return nil, joinErrors(errs)
+}
+
+// joinErrors returns the errors of the attempts, errNoMember if nothing is attempted.
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return errNoMember
+	}
+	return errors.Join(errs...)
+}
+
+func errDeadline(deadline time.Duration) error {
+	return fmt.Errorf("exceeded the retry deadline %s: %w", deadline, context.DeadlineExceeded)
+}
+
+// withTimeout runs the attempt with the timeout.
+func withTimeout(ctx context.Context, timeout time.Duration, attempt func(ctx context.Context) (io.Closer, error)) (io.Closer, error) {
+	if timeout <= 0 {
+		return attempt(ctx)
+	}
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	cancel := func() { cancelCause(nil) }
+	timer := time.AfterFunc(timeout, func() { cancelCause(errAttemptTimeout) })
+	c, err := attempt(ctx)
+	if !timer.Stop() {
+		if err == nil {
+			c.Close()
+		}
+		cancel()
+		// The member that does not answer in time counts as not reached.
+		return nil, &unreachedError{fmt.Errorf("the attempt timed out after %s: %w", timeout, context.DeadlineExceeded)}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return onClose(c, cancel), nil
+}
+
+// errAttemptTimeout is the cause of the ctx of the attempt that timed out.
+var errAttemptTimeout = errors.New("the attempt timed out")
+
+// canceled reports whether the attempt is canceled by the caller or by the race.
+func canceled(ctx context.Context) bool {
+	return ctx.Err() != nil && !errors.Is(context.Cause(ctx), errAttemptTimeout)
+}
+
+// onClose returns the connection or listener that calls release once it is closed.
+func onClose(c io.Closer, release func()) io.Closer {
+	switch c := c.(type) {
+	case net.Conn:
+		return &activeConn{Conn: c, release: release}
+	case net.Listener:
+		return &activeListener{Listener: c, release: release}
+	}
+	return c
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// errorKind returns the kind of the error for config.Retry.On.
+func errorKind(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "authenticat"), strings.Contains(msg, "username/password"):
+		return config.RetryOnAuth
+	case errors.As(err, &dnsErr):
+		return config.RetryOnDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return config.RetryOnTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return config.RetryOnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return config.RetryOnReset
+	}
+	return config.RetryOnOther
+}
@@ -0,0 +1,180 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{
+			err:  errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]"),
+			want: config.RetryOnAuth,
+		},
+		{
+			err:  &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "x"}},
+			want: config.RetryOnDNS,
+		},
+		{
+			err:  fmt.Errorf("dial: %w", context.DeadlineExceeded),
+			want: config.RetryOnTimeout,
+		},
+		{
+			err:  &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+			want: config.RetryOnRefused,
+		},
+		{
+			err:  io.EOF,
+			want: config.RetryOnReset,
+		},
+		{
+			err:  errors.New("refused"),
+			want: config.RetryOnOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := errorKind(tt.err); got != tt.want {
+				t.Errorf("errorKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	// The members fail with the error of their name, except for "ok".
+	errs := map[string]error{
+		"refused": syscall.ECONNREFUSED,
+		"auth":    errors.New("username/password authentication failed"),
+	}
+	tests := []struct {
+		name    string
+		members []string
+		retry   *config.Retry
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "default attempts",
+			members: []string{"refused", "refused", "refused", "ok"},
+			want:    []string{"refused", "refused", "refused"},
+			wantErr: true,
+		},
+		{
+			name:    "more attempts",
+			members: []string{"refused", "refused", "refused", "ok"},
+			retry:   &config.Retry{Attempts: 4},
+			want:    []string{"refused", "refused", "refused", "ok"},
+		},
+		{
+			name:    "start over",
+			members: []string{"refused"},
+			retry:   &config.Retry{Attempts: 2},
+			want:    []string{"refused", "refused"},
+			wantErr: true,
+		},
+		{
+			name:    "auth is not retried",
+			members: []string{"auth", "ok"},
+			want:    []string{"auth"},
+			wantErr: true,
+		},
+		{
+			name:    "auth is retried",
+			members: []string{"auth", "ok"},
+			retry:   &config.Retry{On: []string{config.RetryOnAuth}},
+			want:    []string{"auth", "ok"},
+		},
+		{
+			name:    "refused is not retried",
+			members: []string{"refused", "ok"},
+			retry:   &config.Retry{On: []string{config.RetryOnTimeout}},
+			want:    []string{"refused"},
+			wantErr: true,
+		},
+		{
+			name:    "timeout",
+			members: []string{"slow", "ok"},
+			retry:   &config.Retry{Timeout: 10 * time.Millisecond},
+			want:    []string{"slow", "ok"},
+		},
+		{
+			name:    "deadline",
+			members: []string{"refused", "refused", "ok"},
+			retry:   &config.Retry{Attempts: 3, Backoff: 20 * time.Millisecond, Deadline: 30 * time.Millisecond},
+			want:    []string{"refused", "refused"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mut sync.Mutex
+			var picked []string
+			build := func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+				return bridge.DialFunc(func(ctx context.Context, network, target string) (net.Conn, error) {
+					mut.Lock()
+					picked = append(picked, address)
+					mut.Unlock()
+					if address == "slow" {
+						select {
+						case <-ctx.Done():
+							return nil, ctx.Err()
+						case <-time.After(time.Second):
+							t.Errorf("the slow attempt is not canceled")
+						}
+					}
+					if err := errs[address]; err != nil {
+						return nil, err
+					}
+					c, _ := net.Pipe()
+					return c, nil
+				}), nil
+			}
+			u := newBackoffManager(nil, build, config.Node{LB: tt.members, Retry: tt.retry})
+			_, err := u.DialContext(ctx, "tcp", "x:1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DialContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			mut.Lock()
+			defer mut.Unlock()
+			if !reflect.DeepEqual(picked, tt.want) {
+				t.Errorf("picked %v, want %v", picked, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var attemptCtx context.Context
+	c, err := withTimeout(context.Background(), time.Hour, func(ctx context.Context) (io.Closer, error) {
+		attemptCtx = ctx
+		conn, _ := net.Pipe()
+		return conn, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The connection may be bound to the ctx of the attempt.
+	if attemptCtx.Err() != nil {
+		t.Errorf("the ctx of the success is canceled before it is closed")
+	}
+	c.Close()
+	if attemptCtx.Err() == nil {
+		t.Errorf("the ctx of the success is not canceled after it is closed")
+	}
+}
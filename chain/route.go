@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/internal/route"
+	"github.com/wzshiming/bridge/protocols/local"
+)
+
+// ruleDialer dials the destinations by the route of the first matched rule, the unmatched ones by the dialer.
+type ruleDialer struct {
+	logger *slog.Logger
+	dialer bridge.Dialer
+	rules  []rule
+}
+
+type rule struct {
+	matcher *route.Matcher
+	name    string
+	// dialer is nil for config.RouteReject.
+	dialer bridge.Dialer
+}
+
+// newRuleDialer builds the routes of the rules.
+func (b *Bridge) newRuleDialer(ctx context.Context, chain config.Chain, dialer bridge.Dialer) (*ruleDialer, error) {
+	routes := map[string]bridge.Dialer{
+		config.RouteDirect: local.LOCAL,
+	}
+	for name, hops := range chain.Routes {
+		var d bridge.Dialer = local.LOCAL
+		if len(hops) != 0 {
+			var err error
+			d, err = b.chain.bridgeChainWithLogger(ctx, b.logger, local.LOCAL, withRetry(hops, chain.Retry)...)
+			if err != nil {
+				return nil, fmt.Errorf("route %q: %w", name, err)
+			}
+		}
+		routes[name] = d
+	}
+
+	r := &ruleDialer{
+		logger: b.logger,
+		dialer: dialer,
+	}
+	for _, c := range chain.Rules {
+		matcher, err := route.NewMatcher(c.Conditions())
+		if err != nil {
+			return nil, err
+		}
+		route.WatchLists(ctx, b.logger, matcher.Lists())
+		r.rules = append(r.rules, rule{
+			matcher: matcher,
+			name:    c.Route,
+			dialer:  routes[c.Route],
+		})
+	}
+	return r, nil
+}
+
+func (r *ruleDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	for _, rule := range r.rules {
+		if !rule.matcher.Match(network, address) {
+			continue
+		}
+		r.logger.Debug("Route", "target", address, "route", rule.name)
+		if rule.dialer == nil {
+			return nil, fmt.Errorf("%s is rejected by the rules", address)
+		}
+		return rule.dialer.DialContext(ctx, network, address)
+	}
+	return r.dialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,62 @@
+package chain
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/logger"
+)
+
+func TestRuleDialer(t *testing.T) {
+	var routed string
+	dialer := func(name string) bridge.Dialer {
+		return bridge.DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			routed = name
+			c, _ := net.Pipe()
+			return c, nil
+		})
+	}
+	bc := NewBridgeChain()
+	bc.DialerFunc = nil
+	bc.Register("ssh", bridge.BridgeFunc(func(ctx context.Context, d bridge.Dialer, address string) (bridge.Dialer, error) {
+		return dialer("ssh"), nil
+	}))
+	b := &Bridge{logger: logger.Std, chain: bc}
+	r, err := b.newRuleDialer(context.Background(), config.Chain{
+		Routes: map[string][]config.Node{
+			"corp": {{LB: []string{"ssh://bastion:22"}}},
+		},
+		Rules: []config.Rule{
+			{Domain: []string{"corp"}, Route: "corp"},
+			{CIDR: []string{"10.0.0.0/8"}, Route: config.RouteReject},
+		},
+	}, dialer("default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{address: "git.corp:22", want: "ssh"},
+		{address: "10.0.0.1:80", wantErr: true},
+		{address: "example.org:80", want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			routed = ""
+			_, err := r.DialContext(context.Background(), "tcp", tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DialContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if routed != tt.want {
+				t.Errorf("routed to %q, want %q", routed, tt.want)
+			}
+		})
+	}
+}
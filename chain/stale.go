@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/wzshiming/bridge"
+)
+
+// staleThreshold is the number of the consecutive failures to discard the cached dialer.
+const staleThreshold = breakerThreshold
+
+// cachedDialer is the dialer built for a member, which is reused until it is stale.
+type cachedDialer struct {
+	bridge.Dialer
+	failures int
+	// active is the number of the connections and listeners through the dialer.
+	active    int
+	discarded bool
+}
+
+// closedDialer is implemented by the dialers that hold a client, such as the ssh connection.
+type closedDialer interface {
+	Closed() bool
+}
+
+func isClosed(dialer bridge.Dialer) bool {
+	c, ok := dialer.(closedDialer)
+	return ok && c.Closed()
+}
+
+// dialerDone records the result of the cached dialer of the member.
+func (u *backoffManager) dialerDone(index int, d *cachedDialer, broken bool) {
+	u.mut.Lock()
+	if !broken {
+		d.failures = 0
+		u.mut.Unlock()
+		return
+	}
+	d.failures++
+	if d.failures < staleThreshold {
+		u.mut.Unlock()
+		return
+	}
+	u.mut.Unlock()
+	u.discard(index, d, "failures")
+}
+
+// discard drops the cached dialer of the member, it is closed with its last connection.
+func (u *backoffManager) discard(index int, d *cachedDialer, reason string) {
+	u.mut.Lock()
+	if u.dialers[index] != d {
+		u.mut.Unlock()
+		return
+	}
+	u.dialers[index] = nil
+	d.discarded = true
+	idle := d.active == 0
+	u.mut.Unlock()
+
+	u.logger.Warn("Discard the dialer", "reason", reason, "previous", u.addresses[index])
+	if idle {
+		closeDialer(d)
+	}
+}
+
+// hold counts a connection or listener as active on the cached dialer until the returned func is called.
+func (u *backoffManager) hold(d *cachedDialer) func() {
+	u.mut.Lock()
+	d.active++
+	u.mut.Unlock()
+	return func() {
+		u.mut.Lock()
+		d.active--
+		idle := d.discarded && d.active == 0
+		u.mut.Unlock()
+		if idle {
+			closeDialer(d)
+		}
+	}
+}
+
+func closeDialer(d *cachedDialer) {
+	if c, ok := d.Dialer.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+type activeListener struct {
+	net.Listener
+	once    sync.Once
+	release func()
+}
+
+func (l *activeListener) Close() error {
+	l.once.Do(l.release)
+	return l.Listener.Close()
+}
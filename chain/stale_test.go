@@ -0,0 +1,135 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+)
+
+// fakeClient is a dialer whose client can be closed.
+type fakeClient struct {
+	closed bool
+	fail   bool
+}
+
+func (c *fakeClient) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.closed || c.fail {
+		unreached(ctx)
+		return nil, errors.New("refused")
+	}
+	if address == "dead:1" {
+		return nil, errors.New("refused by the target")
+	}
+	conn, _ := net.Pipe()
+	return conn, nil
+}
+
+func (c *fakeClient) Closed() bool {
+	return c.closed
+}
+
+func (c *fakeClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestStaleDialer(t *testing.T) {
+	ctx := context.Background()
+	var clients []*fakeClient
+	build := func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		c := &fakeClient{}
+		clients = append(clients, c)
+		return c, nil
+	}
+	u := newBackoffManager(nil, build, config.Node{LB: []string{"a"}})
+
+	dialN(t, ctx, u, "x:1", "x:1")
+	if len(clients) != 1 {
+		t.Fatalf("built %d dialers, want 1", len(clients))
+	}
+
+	// The closed client is rebuilt on the next dial.
+	clients[0].closed = true
+	conns := dialN(t, ctx, u, "x:1")
+	if len(clients) != 2 {
+		t.Fatalf("built %d dialers, want 2", len(clients))
+	}
+
+	// The errors of the target do not count.
+	for i := 0; i < staleThreshold; i++ {
+		u.DialContext(ctx, "tcp", "dead:1")
+	}
+	dialN(t, ctx, u, "x:1")[0].Close()
+	if len(clients) != 2 {
+		t.Fatalf("built %d dialers, want 2", len(clients))
+	}
+
+	// The dialer is discarded after the failures in a row,
+	// and closed once its active connections are closed.
+	clients[1].fail = true
+	for i := 0; i < staleThreshold; i++ {
+		u.DialContext(ctx, "tcp", "x:1")
+	}
+	if clients[1].closed {
+		t.Errorf("the stale dialer is closed with an active connection")
+	}
+	conns[0].Close()
+	if !clients[1].closed {
+		t.Errorf("the stale dialer is not closed")
+	}
+	u.breakers[0] = breaker{}
+	dialN(t, ctx, u, "x:1")
+	if len(clients) != 3 {
+		t.Fatalf("built %d dialers, want 3", len(clients))
+	}
+}
+
+func TestStaleDialerConcurrent(t *testing.T) {
+	ctx := context.Background()
+	const n = 4
+	var mut sync.Mutex
+	var clients []*fakeClient
+	var building sync.WaitGroup
+	building.Add(n)
+	build := func(ctx context.Context, dialer bridge.Dialer, address string) (bridge.Dialer, error) {
+		c := &fakeClient{}
+		mut.Lock()
+		clients = append(clients, c)
+		mut.Unlock()
+		// All the dials build their own dialer before any is stored.
+		building.Done()
+		building.Wait()
+		return c, nil
+	}
+	u := newBackoffManager(nil, build, config.Node{LB: []string{"a"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := u.memberDialer(ctx, 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var open int
+	for _, c := range clients {
+		if !c.closed {
+			open++
+			if u.dialers[0].Dialer != c {
+				t.Errorf("the open client is not the cached one")
+			}
+		}
+	}
+	if open != 1 {
+		t.Errorf("%d clients are open, want 1", open)
+	}
+}
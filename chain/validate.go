@@ -0,0 +1,187 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+
+	"github.com/wzshiming/bridge"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/internal/expand"
+	"github.com/wzshiming/bridge/internal/scheme"
+	"github.com/wzshiming/bridge/protocols/local"
+)
+
+// Diagnostic is a problem found in a config file.
+type Diagnostic struct {
+	File string
+	// Chain is the index of the chain in the file, -1 if the problem is not about a chain.
+	Chain int
+	// Field is "bind", "proxy", "backups[i]" or "routes[name]", empty if the problem is about the whole chain.
+	Field string
+	// Hop is the index of the node in the field.
+	Hop int
+	// Warning is true if the chain may still work.
+	Warning bool
+	Err     error
+}
+
+func (d Diagnostic) String() string {
+	level := "error"
+	if d.Warning {
+		level = "warning"
+	}
+	if d.Chain < 0 {
+		return fmt.Sprintf("%s: %v", level, d.Err)
+	}
+	if d.Field == "" {
+		return fmt.Sprintf("%s: chains[%d]: %s: %v", d.File, d.Chain, level, d.Err)
+	}
+	return fmt.Sprintf("%s: chains[%d].%s[%d]: %s: %v", d.File, d.Chain, d.Field, d.Hop, level, d.Err)
+}
+
+// Validate checks the chains of the files without dialing or listening.
+func (b *BridgeChain) Validate(ctx context.Context, files []config.File) []Diagnostic {
+	var diags []Diagnostic
+	proxies, err := config.MergeProxies(files)
+	if err != nil {
+		diags = append(diags, Diagnostic{
+			Chain: -1,
+			Err:   err,
+		})
+	}
+	for _, file := range files {
+		for i, ch := range file.Config.Chains {
+			for _, d := range b.validateChain(ctx, ch.ResolveLists(file.Path), proxies) {
+				d.File = file.Path
+				d.Chain = i
+				diags = append(diags, d)
+			}
+		}
+	}
+	return diags
+}
+
+func (b *BridgeChain) validateChain(ctx context.Context, ch config.Chain, proxies map[string]config.Node) []Diagnostic {
+	ch, err := ch.Resolve(proxies)
+	if err != nil {
+		return []Diagnostic{{Err: err}}
+	}
+	err = ch.Verification()
+	if err != nil {
+		return []Diagnostic{{Err: err}}
+	}
+
+	var diags []Diagnostic
+	for i, node := range ch.Proxy {
+		for _, address := range node.LB {
+			var err error
+			var warning bool
+			switch {
+			case i == 0 && address == "-":
+			case i == 0:
+				err = validateTarget(address)
+			default:
+				_, warning, err = b.validateHop(address)
+			}
+			if err != nil {
+				diags = append(diags, Diagnostic{Field: "proxy", Hop: i, Warning: warning, Err: err})
+			}
+		}
+	}
+	for i, hops := range ch.Backups {
+		diags = append(diags, b.validateHops(fmt.Sprintf("backups[%d]", i), hops)...)
+	}
+	for _, name := range slices.Sorted(maps.Keys(ch.Routes)) {
+		diags = append(diags, b.validateHops(fmt.Sprintf("routes[%q]", name), ch.Routes[name])...)
+	}
+	for i, node := range ch.Bind {
+		for _, address := range node.LB {
+			if i == 0 {
+				err := validateTarget(address)
+				if err != nil {
+					diags = append(diags, Diagnostic{Field: "bind", Hop: i, Err: err})
+				}
+				continue
+			}
+			bridger, warning, err := b.validateHop(address)
+			if err != nil {
+				diags = append(diags, Diagnostic{Field: "bind", Hop: i, Warning: warning, Err: err})
+			}
+			// The hop next to the listening address is the one that listens.
+			if i == 1 && bridger != nil {
+				warning, err := validateListen(ctx, bridger, address)
+				if err != nil {
+					diags = append(diags, Diagnostic{Field: "bind", Hop: i, Warning: warning, Err: err})
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// validateHops checks the hops after the target, such as the backups and the routes.
+func (b *BridgeChain) validateHops(field string, hops []config.Node) []Diagnostic {
+	var diags []Diagnostic
+	for i, node := range hops {
+		for _, address := range node.LB {
+			_, warning, err := b.validateHop(address)
+			if err != nil {
+				diags = append(diags, Diagnostic{Field: field, Hop: i, Warning: warning, Err: err})
+			}
+		}
+	}
+	return diags
+}
+
+func validateTarget(address string) error {
+	_, _, ok := scheme.SplitSchemeAddr(address)
+	if !ok {
+		return fmt.Errorf("unsupported protocol format %q", address)
+	}
+	return nil
+}
+
+// validateHop returns the bridger for the address.
+func (b *BridgeChain) validateHop(address string) (bridge.Bridger, bool, error) {
+	redacted, err := expand.Redact(address, "redacted")
+	if err != nil {
+		return nil, false, err
+	}
+	sch, _, ok := scheme.SplitSchemeAddr(redacted)
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported protocol format %q", address)
+	}
+	bridger, ok := b.proto[sch]
+	if ok {
+		return bridger, false, nil
+	}
+	if b.defaultProto == nil {
+		return nil, false, fmt.Errorf("unsupported protocol %q", sch)
+	}
+	return b.defaultProto, true, fmt.Errorf("unregistered protocol %q is handled by the default bridger", sch)
+}
+
+// validateListen checks that the hop could listen.
+func validateListen(ctx context.Context, bridger bridge.Bridger, address string) (bool, error) {
+	redacted, err := expand.Redact(address, "redacted")
+	if err != nil {
+		return false, err
+	}
+	// Building the dialer may read the local files that exist only on the host that runs the chain.
+	d, err := bridger.Bridge(ctx, local.LOCAL, redacted)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return true, fmt.Errorf("could not check the listen side: %w", err)
+		}
+		return false, err
+	}
+	if _, ok := d.(bridge.ListenConfig); !ok {
+		return false, fmt.Errorf("the proxy %T could not listen", d)
+	}
+	return false, nil
+}
@@ -2,11 +2,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -40,9 +40,17 @@ var (
 	ctx, globalCancel = context.WithCancel(context.Background())
 	allow             []string
 	configs           []string
-	toConfig          bool
+	strict            bool
+	watchConfig       bool
+	watchInterval     time.Duration
+	pollInterval      time.Duration
+	configCacheDir    string
+	toConfig          string
+	toArgs            bool
+	chainIndex        int
 	listens           []string
 	idleTimeout       time.Duration
+	drainTimeout      time.Duration
 	dials             []string
 	dump              bool
 	pprofAddress      string
@@ -51,7 +59,7 @@ var (
 const defaults = `Bridge is a TCP proxy tool Support http(s)-connect socks4/4a/5/5h ssh proxycommand
 More information, please go to https://github.com/wzshiming/bridge
 
-Usage: bridge [-f path/to/config] [-t] [-d] \
+Usage: bridge [validate] [-c path/to/config] [-t] [--to-args [--chain N]] [-d] \
 	[-b=[[(tcp://|unix://)]bind_address]:bind_port \
 	[-b=ssh://bridge_bind_address:bridge_bind_port [-b=(socks4://|socks4a://|socks5://|socks5h://|https://|http://|ssh://|cmd:)bridge_bind_address:bridge_bind_port ...]]] \ // 
 	-p=([(tcp://|unix://)]proxy_address:proxy_port|-) \
@@ -59,14 +67,23 @@ Usage: bridge [-f path/to/config] [-t] [-d] \
 `
 
 func init() {
-	flag.StringSliceVarP(&configs, "config", "c", nil, "load from config and ignore --bind and --proxy")
-	flag.BoolVarP(&toConfig, "to-config", "t", false, "args to config")
+	flag.StringSliceVarP(&configs, "config", "c", nil, "load from config, can be paths, globs, directories or http(s) urls, the chains of --bind and --proxy are appended")
+	flag.BoolVar(&strict, "strict", false, "Fail when a config file could not be read, instead of skipping it.")
+	flag.BoolVar(&watchConfig, "watch", false, "Reload when the config files change, only works on non-Windows.")
+	flag.DurationVar(&watchInterval, "watch-interval", 5*time.Second, "The polling interval of --watch when inotify is not available.")
+	flag.DurationVar(&pollInterval, "config-poll-interval", 30*time.Second, "The polling interval of the http(s) configs, only works on non-Windows.")
+	flag.StringVar(&configCacheDir, "config-cache-dir", "", "The directory to keep the last good copy of the http(s) configs, default is the user cache directory.")
+	flag.StringVarP(&toConfig, "to-config", "t", "", "args to config, the format can be json, jsonc or yaml, and must be given with = such as -t=yaml, a bare -t is json")
+	flag.Lookup("to-config").NoOptDefVal = string(config.FormatJSON)
+	flag.BoolVar(&toArgs, "to-args", false, "config to args, print the equivalent command line of the chain selected by --chain")
+	flag.IntVar(&chainIndex, "chain", -1, "The index of the chain from 0 for --to-args, can be omitted if there is only one chain.")
 	flag.StringSliceVarP(&listens, "bind", "b", nil, "The first is the listening address, and then the proxy through which the listening address passes.\nIf it is not filled in, it is redirected to the pipeline.\nonly ssh and local support listening, so the last proxy must be ssh.")
 	flag.StringSliceVarP(&dials, "proxy", "p", nil, "The first is the dial-up address, followed by the proxy through which the dial-up address passes.")
-	flag.StringSliceVar(&allow, "allow", nil, "The allow of remote addresses.")
-	flag.DurationVar(&idleTimeout, "idle-timeout", 0, "The idle timeout for connections.")
+	flag.StringSliceVar(&allow, "allow", nil, "The allow of remote addresses, the default of the chains that do not set it.")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 0, "The idle timeout for connections, the default of the chains that do not set it.")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 10*time.Second, "The time to wait for the active connections to finish on shutdown and reload, before closing them.")
 	flag.StringVar(&pprofAddress, "pprof", "", "The pprof address.")
-	flag.BoolVarP(&dump, "debug", "d", dump, "Output the communication data.")
+	flag.BoolVarP(&dump, "debug", "d", dump, "Output the communication data, the default of the chains that do not set it.")
 	flag.Parse()
 
 	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
@@ -79,6 +96,87 @@ func init() {
 	})
 }
 
+func loadOptions() config.LoadOptions {
+	return config.LoadOptions{
+		Strict: strict,
+	}
+}
+
+// argsChains loads the chains from the flags or the environment variables.
+func argsChains() ([]config.Chain, error) {
+	if len(listens) == 0 && len(dials) == 0 {
+		tasks, err := config.LoadConfigWithEnv(os.Environ())
+		if err != nil {
+			return nil, err
+		}
+		if len(tasks) != 0 {
+			// The flags take precedence over the environment variables.
+			for i := range tasks {
+				if flag.CommandLine.Changed("allow") {
+					tasks[i].Allow = allow
+				}
+				if flag.CommandLine.Changed("idle-timeout") {
+					tasks[i].IdleTimeout = idleTimeout
+				}
+			}
+			return withDefaults(tasks), nil
+		}
+	}
+
+	tasks, err := config.LoadConfigWithArgs(listens, dials)
+	if err != nil {
+		return nil, err
+	}
+	return withDefaults(tasks), nil
+}
+
+// loadChains loads the chains from --config, and appends the chains of --bind and --proxy.
+func loadChains() ([]config.Chain, error) {
+	tasks, err := config.LoadConfigWithOptions(loadOptions(), configs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(listens) != 0 || len(dials) != 0 {
+		extra, err := config.LoadConfigWithArgs(listens, dials)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, extra...)
+	}
+	return withDefaults(tasks), nil
+}
+
+// withDefaults sets --allow and --idle-timeout to the chains that do not set them.
+func withDefaults(tasks []config.Chain) []config.Chain {
+	for i := range tasks {
+		if len(tasks[i].Allow) == 0 {
+			tasks[i].Allow = allow
+		}
+		if tasks[i].IdleTimeout == 0 {
+			tasks[i].IdleTimeout = idleTimeout
+		}
+	}
+	return tasks
+}
+
+// drain waits for the active connections of the bridges to finish.
+func drain(log *slog.Logger, bridges ...*chain.Bridge) {
+	var wg sync.WaitGroup
+	for _, b := range bridges {
+		if b.ActiveConns() == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(b *chain.Bridge) {
+			defer wg.Done()
+			log.Info("Draining connections", "active", b.ActiveConns(), "timeout", drainTimeout)
+			drained, killed := b.Drain(drainTimeout)
+			log.Info("Drained connections", "drained", drained, "killed", killed)
+		}(b)
+	}
+	wg.Wait()
+}
+
 func printDefaults() {
 	fmt.Fprintf(os.Stderr, defaults)
 	flag.PrintDefaults()
@@ -93,40 +191,66 @@ func main() {
 			}
 		}()
 	}
+	var remotes []*config.Remote
+	if len(configs) != 0 {
+		var err error
+		configs, remotes, err = remoteConfigs(ctx, logger.Std, configs)
+		if err != nil {
+			logger.Std.Error("Fetch config", "err", err)
+			os.Exit(1)
+		}
+	}
+	if flag.Arg(0) == "validate" {
+		os.Exit(runValidate(ctx))
+	}
+
 	var tasks []config.Chain
 	var err error
 	if len(configs) != 0 {
-		tasks, err = config.LoadConfig(configs...)
+		tasks, err = loadChains()
 		if err != nil {
 			printDefaults()
 			logger.Std.Error("LoadConfig", "err", err)
 			return
 		}
 	} else {
-		tasks, err = config.LoadConfigWithArgs(listens, dials)
+		tasks, err = argsChains()
 		if err != nil {
 			printDefaults()
 			logger.Std.Error("LoadConfigWithArgs", "err", err)
 			return
 		}
-		if len(allow) > 0 {
-			for i := range tasks {
-				tasks[i].Allow = allow
-			}
+	}
+
+	if toArgs {
+		command, err := argsCommand(tasks, chainIndex)
+		if err != nil {
+			logger.Std.Error("ToArgs", "err", err)
+			os.Exit(1)
 		}
+		fmt.Println(command)
+		return
 	}
 
-	if toConfig {
-		encoder := json.NewEncoder(os.Stdout)
-		encoder.SetIndent("", "  ")
-		encoder.Encode(config.Config{
+	if toConfig != "" {
+		format, err := config.ParseFormat(toConfig)
+		if err != nil {
+			logger.Std.Error("ParseFormat", "err", err)
+			return
+		}
+		data, err := config.Marshal(format, config.Config{
 			Chains: tasks,
 		})
+		if err != nil {
+			logger.Std.Error("Marshal", "err", err)
+			return
+		}
+		os.Stdout.Write(data)
 		return
 	}
 
 	if len(configs) != 0 {
-		runWithReload(ctx, logger.Std, tasks, configs)
+		runWithReload(ctx, logger.Std, tasks, configs, remotes)
 	} else {
 		run(ctx, logger.Std, tasks)
 	}
@@ -135,20 +259,27 @@ func main() {
 
 func run(ctx context.Context, log *slog.Logger, tasks []config.Chain) {
 	var wg sync.WaitGroup
-	wg.Add(len(tasks))
 	for _, task := range tasks {
-		if task.IdleTimeout == 0 {
-			task.IdleTimeout = idleTimeout
+		if task.Disabled {
+			chain.WithChain(log, task).Info("Skip disabled chain", "chain", showChain(task))
+			continue
 		}
+		wg.Add(1)
 		go func(task config.Chain) {
 			defer wg.Done()
-			log.Info(chain.ShowChainWithConfig(task))
+			chainLog := chain.WithChain(log, task)
+			chainLog.Info(chain.ShowChainWithConfig(task))
 			b := chain.NewBridge(log, dump)
 			err := b.BridgeWithConfig(ctx, task)
 			if err != nil {
-				log.Error("BridgeWithConfig", "err", err)
+				chainLog.Error("BridgeWithConfig", "err", err)
 			}
+			drain(chainLog, b)
 		}(task)
 	}
 	wg.Wait()
 }
+
+func showChain(task config.Chain) string {
+	return strings.TrimSpace(chain.ShowChainWithConfig(task))
+}
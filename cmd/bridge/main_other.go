@@ -5,6 +5,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 	"syscall"
@@ -12,21 +14,55 @@ import (
 
 	"github.com/wzshiming/bridge/chain"
 	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/internal/reload"
+	"github.com/wzshiming/bridge/internal/watch"
 	"github.com/wzshiming/notify"
 )
 
-func runWithReload(ctx context.Context, log *slog.Logger, tasks []config.Chain, configs []string) {
+const (
+	// readyTimeout is the time to wait for a new chain to be ready when reloading.
+	readyTimeout = 10 * time.Second
+	// stopTimeout is the time to wait for a chain to release its listeners.
+	stopTimeout = 5 * time.Second
+)
+
+func runWithReload(ctx context.Context, log *slog.Logger, tasks []config.Chain, configs []string, remotes []*config.Remote) {
 	reloadCn := make(chan struct{}, 1)
-	notify.On(syscall.SIGHUP, func() {
+	trigger := func() {
 		select {
 		case reloadCn <- struct{}{}:
 		default:
 		}
-	})
-	wg := sync.WaitGroup{}
+	}
+	notify.On(syscall.SIGHUP, trigger)
+	if watchConfig {
+		w := &watch.Watcher{
+			Sources: func() ([]string, []string) {
+				return config.Sources(configs...)
+			},
+			OnChange: trigger,
+			Logger:   log,
+			Interval: watchInterval,
+			Debounce: time.Second / 2,
+		}
+		go w.Run(ctx)
+	}
+	for _, remote := range remotes {
+		go remote.Poll(ctx, log, pollInterval, trigger)
+	}
+	var wg sync.WaitGroup
 	defer wg.Wait()
-	var lastWorking = map[string]func(){}
-	var cleanups []func()
+	r := &reload.Reloader{
+		Start: func(ctx context.Context, log *slog.Logger, task config.Chain) *reload.Task {
+			t := start(ctx, log, task, &wg)
+			return &reload.Task{
+				Config: task,
+				Wait:   t.wait,
+				Update: t.update,
+				Stop:   t.stop,
+			}
+		},
+	}
 	count := 1
 	reloadCn <- struct{}{}
 	for {
@@ -36,68 +72,139 @@ func runWithReload(ctx context.Context, log *slog.Logger, tasks []config.Chain,
 		case <-reloadCn:
 		}
 		log := log.With("reload_count", count)
-		tasks, err := config.LoadConfig(configs...)
+		// The globs and includes are expanded again for the new files.
+		tasks, err := loadChains()
 		if err != nil {
 			for {
 				log.Error("LoadConfig", "err", err)
 				log.Info("Try reload again after 1 second")
 				time.Sleep(time.Second)
-				tasks, err = config.LoadConfig(configs...)
+				tasks, err = loadChains()
 				if err == nil {
 					break
 				}
 			}
 		}
-		working := map[string]func(){}
-		for _, task := range tasks {
-			uniq := task.Unique()
+		r.Reload(ctx, log, tasks, count == 1)
+		count++
+	}
+}
 
-			cleanup := lastWorking[uniq]
-			if cleanup != nil {
-				working[uniq] = cleanup
-				continue
-			}
+type runningTask struct {
+	cancel func()
+	ready  chan error
+	done   chan struct{}
 
-			ctx, cancel := context.WithCancel(ctx)
-			working[uniq] = cancel
-			wg.Add(1)
-			go func(ctx context.Context, task config.Chain) {
-				defer wg.Done()
-				log.Info(chain.ShowChainWithConfig(task))
-				for ctx.Err() == nil {
-					b := chain.NewBridge(log, dump)
-					err := b.BridgeWithConfig(ctx, task)
-					if err != nil {
-						log.Error("BridgeWithConfig", "err", err)
-					}
-					time.Sleep(time.Second)
-				}
-			}(ctx, task)
-		}
+	mut    sync.Mutex
+	task   config.Chain
+	bridge *chain.Bridge
+}
 
-		for uniq := range lastWorking {
-			if _, ok := working[uniq]; !ok {
-				cancel := lastWorking[uniq]
-				if cancel != nil {
-					cleanups = append(cleanups, cancel)
-				}
+func start(ctx context.Context, log *slog.Logger, task config.Chain, wg *sync.WaitGroup) *runningTask {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &runningTask{
+		task:   task,
+		cancel: cancel,
+		ready:  make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	chainLog := chain.WithChain(log, task)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var bridges []*chain.Bridge
+		defer func() {
+			// The listeners are closed, drain the connections in the background.
+			close(t.done)
+			drain(chainLog, bridges...)
+		}()
+		chainLog.Info(chain.ShowChainWithConfig(task))
+		for first := true; ctx.Err() == nil; first = false {
+			b := chain.NewBridge(log, dump)
+			bridges = append(activeBridges(bridges), b)
+			t.mut.Lock()
+			task := t.task
+			t.bridge = b
+			t.mut.Unlock()
+			if first {
+				b.NotifyReady(func(err error) {
+					t.ready <- err
+				})
+			}
+			err := b.BridgeWithConfig(ctx, task)
+			if err != nil {
+				chainLog.Error("BridgeWithConfig", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
 			}
 		}
-		lastWorking = working
+	}()
+	return t
+}
 
-		// TODO: wait for all task is working
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(time.Second):
+// wait waits for the task to be ready, and then probes its first hop if probe is true.
+func (t *runningTask) wait(ctx context.Context, probe bool) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("not ready after %s", readyTimeout)
 		}
+		return ctx.Err()
+	case err := <-t.ready:
+		if err != nil || !probe {
+			return err
+		}
+	}
+	t.mut.Lock()
+	b := t.bridge
+	t.mut.Unlock()
+	return b.Probe(ctx)
+}
 
-		if len(cleanups) > 0 {
-			for _, cleanup := range cleanups {
-				cleanup()
-			}
-			cleanups = cleanups[:0]
+// update swaps the dial side of the task, and keeps its listeners.
+func (t *runningTask) update(ctx context.Context, task config.Chain) error {
+	t.mut.Lock()
+	b := t.bridge
+	t.mut.Unlock()
+	if b == nil {
+		return chain.ErrNotRunning
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	err := b.Update(ctx, task)
+	if err != nil {
+		return err
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.bridge != b {
+		// The chain is restarted meanwhile with the previous config.
+		return chain.ErrNotRunning
+	}
+	t.task = task
+	return nil
+}
+
+// stop stops the task and waits for its listeners to be closed.
+func (t *runningTask) stop() {
+	t.cancel()
+	select {
+	case <-t.done:
+	case <-time.After(stopTimeout):
+	}
+}
+
+// activeBridges returns the bridges that still have active connections.
+func activeBridges(bridges []*chain.Bridge) []*chain.Bridge {
+	active := bridges[:0]
+	for _, b := range bridges {
+		if b.ActiveConns() != 0 {
+			active = append(active, b)
 		}
-		count++
 	}
+	return active
 }
@@ -10,6 +10,6 @@ import (
 	"github.com/wzshiming/bridge/config"
 )
 
-func runWithReload(ctx context.Context, log *slog.Logger, tasks []config.Chain, configs []string) {
+func runWithReload(ctx context.Context, log *slog.Logger, tasks []config.Chain, configs []string, remotes []*config.Remote) {
 	run(ctx, log, tasks)
 }
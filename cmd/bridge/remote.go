@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+// remoteConfigs fetches the remote configs, and replaces their urls with the cached copies.
+func remoteConfigs(ctx context.Context, log *slog.Logger, configs []string) ([]string, []*config.Remote, error) {
+	var remotes []*config.Remote
+	out := make([]string, 0, len(configs))
+	for _, c := range configs {
+		if !config.IsRemote(c) {
+			out = append(out, c)
+			continue
+		}
+		r, err := config.NewRemote(c, remoteCacheDir())
+		if err != nil {
+			return nil, nil, err
+		}
+		remotes = append(remotes, r)
+		out = append(out, r.Path())
+	}
+	// The fetched configs can refer to the proxies of the other configs.
+	for _, r := range remotes {
+		r.Others = out
+		_, err := r.Fetch(ctx)
+		if err != nil {
+			if _, statErr := os.Stat(r.Path()); statErr != nil {
+				return nil, nil, err
+			}
+			log.Warn("Fetch config, use the last good copy", "err", err, "url", r.URL, "path", r.Path())
+		}
+	}
+	return out, remotes, nil
+}
+
+func remoteCacheDir() string {
+	if configCacheDir != "" {
+		return configCacheDir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "bridge")
+}
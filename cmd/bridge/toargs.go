@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/logger"
+)
+
+// argsCommand returns the command line of the chain, quoted for the shell.
+func argsCommand(tasks []config.Chain, index int) (string, error) {
+	if index < 0 {
+		if len(tasks) != 1 {
+			return "", fmt.Errorf("there are %d chains, select one with --chain", len(tasks))
+		}
+		index = 0
+	}
+	if index >= len(tasks) {
+		return "", fmt.Errorf("chain %d is out of range, there are %d chains", index, len(tasks))
+	}
+	args, err := tasks[index].Args()
+	if err != nil {
+		return "", fmt.Errorf("chain %d: %w", index, err)
+	}
+	for _, field := range tasks[index].OmittedArgs() {
+		logger.Std.Warn("The field could not be flags, it is omitted", "chain", index, "field", field)
+	}
+	quoted := []string{"bridge"}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/wzshiming/bridge/chain"
+	"github.com/wzshiming/bridge/config"
+)
+
+// runValidate checks the chains from --config or the args, and returns the exit code.
+func runValidate(ctx context.Context) int {
+	var files []config.File
+	if len(configs) != 0 {
+		fs, err := config.ReadFiles(config.LoadOptions{Strict: true}, configs...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		files = fs
+	}
+	// The chains of the flags are appended to the configs.
+	if len(configs) == 0 || len(listens) != 0 || len(dials) != 0 {
+		tasks, err := argsChains()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		files = append(files, config.File{
+			Path: "args",
+			Config: config.Config{
+				Chains: tasks,
+			},
+		})
+	}
+
+	errs := 0
+	for _, diag := range chain.Default.Validate(ctx, files) {
+		fmt.Fprintln(os.Stderr, diag.String())
+		if !diag.Warning {
+			errs++
+		}
+	}
+	if errs != 0 {
+		return 1
+	}
+	return 0
+}
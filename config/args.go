@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Args returns the flags of the chain, which are loaded back by LoadConfigWithArgs.
+func (c Chain) Args() ([]string, error) {
+	err := c.Verification()
+	if err != nil {
+		return nil, err
+	}
+	if c.Disabled {
+		return nil, fmt.Errorf("the chain is disabled")
+	}
+	if fields := c.unflaggedArgs(); len(fields) != 0 {
+		return nil, fmt.Errorf("%s of the chain could not be flags", strings.Join(fields, ", "))
+	}
+	binds, err := nodesArgs("bind", c.Bind)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := nodesArgs("proxy", c.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	// The flags may be loaded differently, such as the proxy mode.
+	chains, err := LoadConfigWithArgs(append([]string(nil), binds...), proxies)
+	if err != nil {
+		return nil, err
+	}
+	got := chains[0]
+	got.Allow = c.Allow
+	got.IdleTimeout = c.IdleTimeout
+	// See OmittedArgs.
+	got.Name = c.Name
+	got.Labels = c.Labels
+	got.Debug = c.Debug
+	if len(got.Bind) == 0 && len(c.Bind) == 0 {
+		got.Bind = c.Bind
+	}
+	if got.Unique() != c.Unique() {
+		return nil, fmt.Errorf("the chain is loaded differently from the flags: %s", got.Unique())
+	}
+
+	var args []string
+	for _, bind := range binds {
+		args = append(args, "-b", sliceValue(bind))
+	}
+	for _, proxy := range proxies {
+		args = append(args, "-p", sliceValue(proxy))
+	}
+	for _, allow := range c.Allow {
+		args = append(args, "--allow", sliceValue(allow))
+	}
+	if c.IdleTimeout != 0 {
+		args = append(args, "--idle-timeout", c.IdleTimeout.String())
+	}
+	if c.Debug != nil && *c.Debug {
+		args = append(args, "--debug")
+	}
+	return args, nil
+}
+
+// OmittedArgs returns the fields of the chain that only annotate the logs and are left out of Args.
+func (c Chain) OmittedArgs() []string {
+	var fields []string
+	if c.Name != "" {
+		fields = append(fields, "name")
+	}
+	if len(c.Labels) != 0 {
+		fields = append(fields, "labels")
+	}
+	return fields
+}
+
+// unflaggedArgs returns the fields of the chain that are set but have no flags.
+func (c Chain) unflaggedArgs() []string {
+	var fields []string
+	if c.Retry != nil {
+		fields = append(fields, "retry")
+	}
+	if len(c.Backups) != 0 {
+		fields = append(fields, "backups")
+	}
+	if len(c.Routes) != 0 {
+		fields = append(fields, "routes")
+	}
+	if len(c.Rules) != 0 {
+		fields = append(fields, "rules")
+	}
+	return fields
+}
+
+func nodesArgs(field string, nodes []Node) ([]string, error) {
+	out := make([]string, 0, len(nodes))
+	for i, node := range nodes {
+		if len(node.LB) == 0 {
+			return nil, fmt.Errorf("%s[%d]: empty node", field, i)
+		}
+		if node.HasOptions() {
+			return nil, fmt.Errorf("%s[%d]: the options of the node could not be flags", field, i)
+		}
+		for _, addr := range node.LB {
+			if strings.Contains(addr, "|") {
+				return nil, fmt.Errorf("%s[%d]: %q contains '|'", field, i, addr)
+			}
+		}
+		out = append(out, strings.Join(node.LB, "|"))
+	}
+	return out, nil
+}
+
+// sliceValue quotes the value of a slice flag, which is parsed as CSV.
+func sliceValue(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
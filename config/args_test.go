@@ -0,0 +1,162 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestChainArgs(t *testing.T) {
+	debug := true
+	tests := []struct {
+		name    string
+		chain   Chain
+		want    []string
+		omitted []string
+		wantErr bool
+	}{
+		{
+			name: "forward",
+			chain: Chain{
+				Bind:        []Node{{LB: []string{":8080"}}},
+				Proxy:       []Node{{LB: []string{"example.org:80"}}, {LB: []string{"socks5://a:1080", "socks5://b:1080"}}},
+				Allow:       []string{"10.0.0.0/8", "a,b"},
+				IdleTimeout: time.Minute,
+			},
+			want: []string{"-b", ":8080", "-p", "example.org:80", "-p", "socks5://a:1080|socks5://b:1080", "--allow", "10.0.0.0/8", "--allow", `"a,b"`, "--idle-timeout", "1m0s"},
+		},
+		{
+			name: "stdio",
+			chain: Chain{
+				Proxy: []Node{{LB: []string{"example.org:22"}}},
+			},
+			want: []string{"-p", "example.org:22"},
+		},
+		{
+			name: "proxy mode",
+			chain: Chain{
+				Bind:  []Node{{LB: []string{"http://:8080", "socks5://:8080"}}},
+				Proxy: []Node{{LB: []string{"-"}}},
+			},
+			want: []string{"-b", "http://:8080|socks5://:8080", "-p", "-"},
+		},
+		{
+			name: "proxy mode expanded by the flags",
+			chain: Chain{
+				Bind:  []Node{{LB: []string{":8080"}}},
+				Proxy: []Node{{LB: []string{"-"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "named",
+			chain: Chain{
+				Name:   "web",
+				Labels: map[string]string{"team": "infra"},
+				Proxy:  []Node{{LB: []string{"example.org:80"}}},
+			},
+			want:    []string{"-p", "example.org:80"},
+			omitted: []string{"name", "labels"},
+		},
+		{
+			name: "debug",
+			chain: Chain{
+				Proxy: []Node{{LB: []string{"example.org:80"}}},
+				Debug: &debug,
+			},
+			want: []string{"-p", "example.org:80", "--debug"},
+		},
+		{
+			name: "disabled",
+			chain: Chain{
+				Disabled: true,
+				Proxy:    []Node{{LB: []string{"example.org:80"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "separator in address",
+			chain: Chain{
+				Proxy: []Node{{LB: []string{"cmd:a|b"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "backups",
+			chain: Chain{
+				Proxy:   []Node{{LB: []string{"example.org:80"}}, {LB: []string{"socks5://a:1080"}}},
+				Backups: [][]Node{{{LB: []string{"socks5://b:1080"}}}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no proxy",
+			chain:   Chain{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.chain.Args()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Args() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Args() got = %q, want %q", got, tt.want)
+			}
+			if omitted := tt.chain.OmittedArgs(); !reflect.DeepEqual(omitted, tt.omitted) {
+				t.Errorf("OmittedArgs() got = %q, want %q", omitted, tt.omitted)
+			}
+
+			// Parse the flags the same way as the command does.
+			var binds, proxies, allow []string
+			var idleTimeout time.Duration
+			var dump bool
+			fs := flag.NewFlagSet("bridge", flag.ContinueOnError)
+			fs.StringSliceVarP(&binds, "bind", "b", nil, "")
+			fs.StringSliceVarP(&proxies, "proxy", "p", nil, "")
+			fs.StringSliceVar(&allow, "allow", nil, "")
+			fs.DurationVar(&idleTimeout, "idle-timeout", 0, "")
+			fs.BoolVarP(&dump, "debug", "d", false, "")
+			err = fs.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chains, err := LoadConfigWithArgs(binds, proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain := chains[0]
+			chain.Allow = allow
+			chain.IdleTimeout = idleTimeout
+			chain.Name = tt.chain.Name
+			chain.Labels = tt.chain.Labels
+			if dump {
+				chain.Debug = &dump
+			}
+			if len(chain.Bind) == 0 {
+				chain.Bind = tt.chain.Bind
+			}
+			if chain.Unique() != tt.chain.Unique() {
+				t.Errorf("round trip got = %s, want %s", chain.Unique(), tt.chain.Unique())
+			}
+		})
+	}
+}
+
+func TestChainArgsUnflagged(t *testing.T) {
+	chain := Chain{
+		Proxy:   []Node{{LB: []string{"example.org:80"}}, {LB: []string{"socks5://a:1080"}}},
+		Retry:   &Retry{Attempts: 2},
+		Backups: [][]Node{{{LB: []string{"socks5://b:1080"}}}},
+	}
+	_, err := chain.Args()
+	if err == nil || err.Error() != "retry, backups of the chain could not be flags" {
+		t.Errorf("Args() error = %v, want the fields named", err)
+	}
+}
@@ -3,18 +3,18 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/wzshiming/bridge/internal/expand"
 	"github.com/wzshiming/bridge/internal/scheme"
-	"github.com/wzshiming/bridge/logger"
 )
 
 func LoadConfigWithArgs(listens []string, dials []string) ([]Chain, error) {
 	if len(dials) > 0 && len(listens) > 0 && dials[0] == "-" {
-		proxies := strings.Split(listens[0], "|")
+		proxies := expand.Split(listens[0], "|")
 		if len(proxies) == 1 {
 			network, address, _ := scheme.SplitSchemeAddr(proxies[0])
 			if network == "tcp" {
@@ -50,48 +50,264 @@ func anyProxy(address string) []string {
 	return []string{"http://" + address, "socks5://" + address, "socks4://" + address, "ssh://" + address}
 }
 
+// LoadConfig loads the chains from config files, the unreadable files are skipped.
 func LoadConfig(configs ...string) ([]Chain, error) {
+	return LoadConfigWithOptions(LoadOptions{}, configs...)
+}
+
+// LoadConfigWithOptions loads the chains from config files.
+func LoadConfigWithOptions(opts LoadOptions, configs ...string) ([]Chain, error) {
+	files, err := ReadFiles(opts, configs...)
+	if err != nil {
+		return nil, err
+	}
+	return ChainsFromFiles(files)
+}
+
+// ChainsFromFiles returns the resolved chains of the files.
+func ChainsFromFiles(files []File) ([]Chain, error) {
+	proxies, err := MergeProxies(files)
+	if err != nil {
+		return nil, err
+	}
 	tasks := []Chain{}
-	for _, confPath := range configs {
-		data, err := os.ReadFile(confPath)
+	for _, file := range files {
+		chains, err := file.chains(proxies)
 		if err != nil {
-			logger.Std.Error("LoadConfig", "err", err, "path", confPath)
-			continue
+			return nil, err
 		}
-		conf := Config{}
-		err = json.Unmarshal(data, &conf)
+		tasks = append(tasks, chains...)
+	}
+	return tasks, nil
+}
+
+// chains returns the resolved chains of the file with the proxies of all files.
+func (file File) chains(proxies map[string]Node) ([]Chain, error) {
+	tasks := []Chain{}
+	for _, ch := range file.Config.Chains {
+		if lists := ch.relativeLists(); len(lists) != 0 && IsRemote(file.Path) {
+			return nil, fmt.Errorf("%s: the list %q of a remote config must be an absolute path", file.Path, lists[0])
+		}
+		ch, err := ch.ResolveLists(file.Path).Resolve(proxies)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: %w", file.Path, err)
 		}
-		for _, ch := range conf.Chains {
-			err := ch.Verification()
-			if err != nil {
-				return nil, fmt.Errorf("%s: %w", confPath, err)
-			}
-			tasks = append(tasks, ch)
+		err = ch.Verification()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Path, err)
 		}
+		tasks = append(tasks, ch)
 	}
 	return tasks, nil
 }
 
+// MergeProxies returns the proxies defined in all files, a name can only be defined once.
+func MergeProxies(files []File) (map[string]Node, error) {
+	proxies := map[string]Node{}
+	from := map[string]string{}
+	for _, file := range files {
+		for name, node := range file.Config.Proxies {
+			if path, ok := from[name]; ok {
+				return nil, fmt.Errorf("%s: proxy %q is already defined in %s", file.Path, name, path)
+			}
+			proxies[name] = node
+			from[name] = file.Path
+		}
+	}
+	return proxies, nil
+}
+
 type Config struct {
-	Chains []Chain `json:"chains"`
+	// Schema is the JSON Schema of the file for the editors.
+	Schema  string          `json:"$schema,omitempty"`
+	Include []string        `json:"include,omitempty"`
+	Proxies map[string]Node `json:"proxies,omitempty"`
+	Chains  []Chain         `json:"chains"`
 }
 
 type Chain struct {
+	// Name and Labels identify the chain in the logs.
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Disabled chains are kept in the config but not run.
+	Disabled bool `json:"disabled,omitempty"`
+
 	Bind        []Node        `json:"bind"`
 	Proxy       []Node        `json:"proxy"`
 	Allow       []string      `json:"allow"`
 	IdleTimeout time.Duration `json:"idle_timeout"`
+	// Debug outputs the communication data, the default is --debug.
+	Debug *bool `json:"debug,omitempty"`
+	// Retry is the default retry policy of the proxies.
+	Retry *Retry `json:"retry,omitempty"`
+	// Backups are the alternative hops of the Proxy after the target, an empty one dials directly.
+	Backups [][]Node `json:"backups,omitempty"`
+	// Routes are the named hops after the target for the Rules, an empty one dials directly.
+	Routes map[string][]Node `json:"routes,omitempty"`
+	// Rules route the destinations to the Routes in order, the unmatched ones use the Proxy.
+	Rules []Rule `json:"rules,omitempty"`
 }
 
 func (c Chain) Verification() error {
 	if len(c.Proxy) == 0 {
 		return fmt.Errorf("must has proxy")
 	}
+	if c.Retry != nil {
+		err := c.Retry.verify()
+		if err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+	for i, node := range c.Proxy {
+		err := node.verify(i != 0)
+		if err != nil {
+			return fmt.Errorf("proxy[%d]: %w", i, err)
+		}
+	}
+	for i, node := range c.Bind {
+		err := node.verify(i != 0)
+		if err != nil {
+			return fmt.Errorf("bind[%d]: %w", i, err)
+		}
+	}
+	for i, hops := range c.Backups {
+		for j, node := range hops {
+			err := node.verify(true)
+			if err != nil {
+				return fmt.Errorf("backups[%d][%d]: %w", i, j, err)
+			}
+		}
+	}
+	for name, hops := range c.Routes {
+		if name == RouteDirect || name == RouteReject {
+			return fmt.Errorf("routes: %q is reserved", name)
+		}
+		for j, node := range hops {
+			err := node.verify(true)
+			if err != nil {
+				return fmt.Errorf("routes[%q][%d]: %w", name, j, err)
+			}
+		}
+	}
+	for i, rule := range c.Rules {
+		err := rule.verify(c.Routes)
+		if err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+	}
 	return nil
 }
 
+// Resolve returns a copy of the chain with the references to named proxies replaced by their definitions.
+func (c Chain) Resolve(proxies map[string]Node) (Chain, error) {
+	bind, err := resolveNodes(proxies, c.Bind)
+	if err != nil {
+		return c, err
+	}
+	proxy, err := resolveNodes(proxies, c.Proxy)
+	if err != nil {
+		return c, err
+	}
+	var backups [][]Node
+	for _, hops := range c.Backups {
+		hops, err := resolveNodes(proxies, hops)
+		if err != nil {
+			return c, err
+		}
+		backups = append(backups, hops)
+	}
+	var routes map[string][]Node
+	for name, hops := range c.Routes {
+		hops, err := resolveNodes(proxies, hops)
+		if err != nil {
+			return c, err
+		}
+		if routes == nil {
+			routes = map[string][]Node{}
+		}
+		routes[name] = hops
+	}
+	c.Bind = bind
+	c.Proxy = proxy
+	c.Backups = backups
+	c.Routes = routes
+	return c, nil
+}
+
+func resolveNodes(proxies map[string]Node, nodes []Node) ([]Node, error) {
+	if nodes == nil {
+		return nil, nil
+	}
+	out := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		lb, err := resolveLB(proxies, node.LB, nil)
+		if err != nil {
+			return nil, err
+		}
+		// A node that is only a reference uses the options of the definition.
+		if len(node.LB) == 1 && !node.HasOptions() {
+			if name, ok := strings.CutPrefix(node.LB[0], "@"); ok {
+				node = proxies[name]
+			}
+		}
+		node.LB = lb
+		out = append(out, node)
+	}
+	return out, nil
+}
+
+func resolveLB(proxies map[string]Node, lb []string, visiting []string) ([]string, error) {
+	out := make([]string, 0, len(lb))
+	for _, addr := range lb {
+		name, ok := strings.CutPrefix(addr, "@")
+		if !ok {
+			out = append(out, addr)
+			continue
+		}
+		for _, v := range visiting {
+			if v == name {
+				return nil, fmt.Errorf("circular reference to proxy %q", addr)
+			}
+		}
+		def, ok := proxies[name]
+		if !ok {
+			return nil, fmt.Errorf("undefined proxy %q", addr)
+		}
+		sub, err := resolveLB(proxies, def.LB, append(visiting, name))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sub...)
+	}
+	return out, nil
+}
+
+// IsProxyMode reports whether the chain serves the proxy protocols instead of forwarding to the targets.
+func (c Chain) IsProxyMode() bool {
+	return len(c.Proxy) != 0 && len(c.Proxy[0].LB) != 0 && c.Proxy[0].LB[0] == "-"
+}
+
+// ListenUnique returns the identity of the listen side of the chain, the chains with the same one can share the listeners.
+func (c Chain) ListenUnique() string {
+	d, err := json.Marshal(struct {
+		Bind      []Node            `json:"bind"`
+		ProxyMode bool              `json:"proxy_mode"`
+		Name      string            `json:"name,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		Debug     *bool             `json:"debug,omitempty"`
+	}{
+		Bind:      c.Bind,
+		ProxyMode: c.IsProxyMode(),
+		Name:      c.Name,
+		Labels:    c.Labels,
+		Debug:     c.Debug,
+	})
+	if err != nil {
+		return ""
+	}
+	return string(d)
+}
+
 func (c Chain) Unique() string {
 	d, err := json.Marshal(c)
 	if err != nil {
@@ -102,10 +318,30 @@ func (c Chain) Unique() string {
 
 type Node struct {
 	LB []string `json:"lb"`
+	// Strategy picks the member of LB to use for each connection, see the Strategy constants.
+	Strategy string `json:"strategy,omitempty"`
+	// Weights of the members for StrategyWeighted, in the same order as LB.
+	Weights []int `json:"weights,omitempty"`
+	// Priorities of the members, in the same order as LB, the lower one is preferred.
+	Priorities []int `json:"priorities,omitempty"`
+	// HashKey is HashKeyClient or HashKeyTarget for StrategyHash, defaults to HashKeyTarget.
+	HashKey string `json:"hash_key,omitempty"`
+	// HealthCheck probes the members, the unhealthy members are not used.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	// Retry is the policy of trying the members, defaults to the Retry of the chain.
+	Retry *Retry `json:"retry,omitempty"`
+	// Race dials the members in parallel, the next one joins after the Stagger, defaults to 250ms.
+	Race    bool          `json:"race,omitempty"`
+	Stagger time.Duration `json:"stagger,omitempty"`
+}
+
+// HasOptions reports whether the node has more than the members.
+func (m Node) HasOptions() bool {
+	return !reflect.DeepEqual(m, Node{LB: m.LB})
 }
 
 func (m Node) MarshalJSON() ([]byte, error) {
-	if len(m.LB) == 1 {
+	if len(m.LB) == 1 && !m.HasOptions() {
 		return json.Marshal(m.LB[0])
 	}
 	type node Node
@@ -123,7 +359,7 @@ func (m *Node) UnmarshalJSON(data []byte) error {
 			if err != nil {
 				return err
 			}
-			m.LB = strings.Split(str, "|")
+			m.LB = expand.Split(str, "|")
 			return nil
 		case '[':
 			return json.Unmarshal(data, &m.LB)
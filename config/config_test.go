@@ -0,0 +1,136 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChainResolve(t *testing.T) {
+	proxies := map[string]Node{
+		"bastion": {LB: []string{"ssh://user@bastion?identity_file=~/.ssh/id_rsa"}},
+		"corp":    {LB: []string{"http://corp-proxy:8080", "@bastion"}},
+		"loop":    {LB: []string{"@loop"}},
+		"pool":    {LB: []string{"socks5://a:1080", "socks5://b:1080"}, Strategy: StrategyWeighted, Weights: []int{2, 1}},
+	}
+	tests := []struct {
+		name    string
+		chain   Chain
+		want    Chain
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			chain: Chain{
+				Bind:  []Node{{LB: []string{":8080"}}},
+				Proxy: []Node{{LB: []string{"example.org:80"}}},
+			},
+			want: Chain{
+				Bind:  []Node{{LB: []string{":8080"}}},
+				Proxy: []Node{{LB: []string{"example.org:80"}}},
+			},
+		},
+		{
+			name: "reference",
+			chain: Chain{
+				Bind:  []Node{{LB: []string{":8080"}}, {LB: []string{"@bastion"}}},
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"@corp", "socks5://other:1080"}}},
+			},
+			want: Chain{
+				Bind:  []Node{{LB: []string{":8080"}}, {LB: []string{"ssh://user@bastion?identity_file=~/.ssh/id_rsa"}}},
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"http://corp-proxy:8080", "ssh://user@bastion?identity_file=~/.ssh/id_rsa", "socks5://other:1080"}}},
+			},
+		},
+		{
+			name: "reference with options",
+			chain: Chain{
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"@pool"}}},
+			},
+			want: Chain{
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"socks5://a:1080", "socks5://b:1080"}, Strategy: StrategyWeighted, Weights: []int{2, 1}}},
+			},
+		},
+		{
+			name: "backups",
+			chain: Chain{
+				Proxy:   []Node{{LB: []string{"example.org:80"}}, {LB: []string{"@bastion"}}},
+				Backups: [][]Node{{{LB: []string{"@pool"}}}, {}},
+			},
+			want: Chain{
+				Proxy:   []Node{{LB: []string{"example.org:80"}}, {LB: []string{"ssh://user@bastion?identity_file=~/.ssh/id_rsa"}}},
+				Backups: [][]Node{{{LB: []string{"socks5://a:1080", "socks5://b:1080"}, Strategy: StrategyWeighted, Weights: []int{2, 1}}}, {}},
+			},
+		},
+		{
+			name: "undefined",
+			chain: Chain{
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"@undefined"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "circular",
+			chain: Chain{
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"@loop"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.chain.Resolve(proxies)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenUnique(t *testing.T) {
+	debug := true
+	base := Chain{
+		Bind:  []Node{{LB: []string{":8080"}}},
+		Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"ssh://a:22"}}},
+	}
+	tests := []struct {
+		name   string
+		change func(c *Chain)
+		same   bool
+	}{
+		{
+			name:   "proxy",
+			change: func(c *Chain) { c.Proxy = []Node{{LB: []string{"example.org:80"}}, {LB: []string{"ssh://b:22"}}} },
+			same:   true,
+		},
+		{
+			name:   "bind",
+			change: func(c *Chain) { c.Bind = []Node{{LB: []string{":8081"}}} },
+		},
+		{
+			name:   "name",
+			change: func(c *Chain) { c.Name = "web" },
+		},
+		{
+			name:   "labels",
+			change: func(c *Chain) { c.Labels = map[string]string{"env": "prod"} },
+		},
+		{
+			name:   "debug",
+			change: func(c *Chain) { c.Debug = &debug },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base
+			tt.change(&c)
+			if got := c.ListenUnique() == base.ListenUnique(); got != tt.same {
+				t.Errorf("ListenUnique() is the same = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envPrefix = "BRIDGE_"
+
+// envChain is the chain from the environment variables, the values are the same as the flags.
+type envChain struct {
+	bind        string
+	proxy       string
+	allow       string
+	idleTimeout string
+}
+
+func (e *envChain) set(key, value string) bool {
+	switch key {
+	case "BIND":
+		e.bind = value
+	case "PROXY":
+		e.proxy = value
+	case "ALLOW":
+		e.allow = value
+	case "IDLE_TIMEOUT":
+		e.idleTimeout = value
+	default:
+		return false
+	}
+	return true
+}
+
+// LoadConfigWithEnv loads the chains from BRIDGE_BIND, BRIDGE_PROXY, ... and BRIDGE_CHAIN_<n>_BIND, ...
+func LoadConfigWithEnv(environ []string) ([]Chain, error) {
+	var global envChain
+	numbered := map[int]*envChain{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		key, ok = strings.CutPrefix(key, envPrefix)
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(key, "CHAIN_")
+		if !ok {
+			if !global.set(key, value) {
+				return nil, fmt.Errorf("%s%s: unknown variable", envPrefix, key)
+			}
+			continue
+		}
+		num, field, ok := strings.Cut(rest, "_")
+		n, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%s%s: want %sCHAIN_<n>_<field>", envPrefix, key, envPrefix)
+		}
+		e := numbered[n]
+		if e == nil {
+			e = &envChain{}
+			numbered[n] = e
+		}
+		if !e.set(field, value) {
+			return nil, fmt.Errorf("%s%s: unknown field %q", envPrefix, key, field)
+		}
+	}
+
+	var chains []Chain
+	if global.bind != "" || global.proxy != "" {
+		chain, err := global.chain(envPrefix, envChain{})
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+
+	nums := make([]int, 0, len(numbered))
+	for n := range numbered {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	for _, n := range nums {
+		chain, err := numbered[n].chain(fmt.Sprintf("%sCHAIN_%d_", envPrefix, n), global)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+func (e envChain) chain(prefix string, defaults envChain) (Chain, error) {
+	if e.allow == "" {
+		e.allow = defaults.allow
+	}
+	if e.idleTimeout == "" {
+		e.idleTimeout = defaults.idleTimeout
+	}
+
+	binds, err := envList(e.bind)
+	if err != nil {
+		return Chain{}, fmt.Errorf("%sBIND: %w", prefix, err)
+	}
+	proxies, err := envList(e.proxy)
+	if err != nil {
+		return Chain{}, fmt.Errorf("%sPROXY: %w", prefix, err)
+	}
+	allow, err := envList(e.allow)
+	if err != nil {
+		return Chain{}, fmt.Errorf("%sALLOW: %w", prefix, err)
+	}
+	chains, err := LoadConfigWithArgs(binds, proxies)
+	if err != nil {
+		return Chain{}, fmt.Errorf("%sPROXY: %w", prefix, err)
+	}
+	chain := chains[0]
+	chain.Allow = allow
+	if e.idleTimeout != "" {
+		chain.IdleTimeout, err = time.ParseDuration(e.idleTimeout)
+		if err != nil {
+			return Chain{}, fmt.Errorf("%sIDLE_TIMEOUT: %w", prefix, err)
+		}
+	}
+	return chain, nil
+}
+
+// envList splits the value the same way as the slice flags.
+func envList(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return csv.NewReader(strings.NewReader(value)).Read()
+}
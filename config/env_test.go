@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigWithEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    []Chain
+		wantErr bool
+	}{
+		{
+			name:    "none",
+			environ: []string{"HOME=/root"},
+		},
+		{
+			name:    "unknown variable",
+			environ: []string{"BRIDGE_PROXYY=example.org:80"},
+			wantErr: true,
+		},
+		{
+			name: "single",
+			environ: []string{
+				"BRIDGE_BIND=:8080",
+				"BRIDGE_PROXY=example.org:80,socks5://a:1080|socks5://b:1080",
+				"BRIDGE_ALLOW=10.0.0.0/8,192.168.0.0/16",
+				"BRIDGE_IDLE_TIMEOUT=1m",
+			},
+			want: []Chain{
+				{
+					Bind:        []Node{{LB: []string{":8080"}}},
+					Proxy:       []Node{{LB: []string{"example.org:80"}}, {LB: []string{"socks5://a:1080", "socks5://b:1080"}}},
+					Allow:       []string{"10.0.0.0/8", "192.168.0.0/16"},
+					IdleTimeout: time.Minute,
+				},
+			},
+		},
+		{
+			name: "numbered",
+			environ: []string{
+				"BRIDGE_ALLOW=10.0.0.0/8",
+				"BRIDGE_CHAIN_10_BIND=:8082",
+				"BRIDGE_CHAIN_10_PROXY=example.org:443",
+				"BRIDGE_CHAIN_2_BIND=:8081",
+				"BRIDGE_CHAIN_2_PROXY=example.org:80",
+				"BRIDGE_CHAIN_2_ALLOW=127.0.0.1",
+			},
+			want: []Chain{
+				{
+					Bind:  []Node{{LB: []string{":8081"}}},
+					Proxy: []Node{{LB: []string{"example.org:80"}}},
+					Allow: []string{"127.0.0.1"},
+				},
+				{
+					Bind:  []Node{{LB: []string{":8082"}}},
+					Proxy: []Node{{LB: []string{"example.org:443"}}},
+					Allow: []string{"10.0.0.0/8"},
+				},
+			},
+		},
+		{
+			name:    "no proxy",
+			environ: []string{"BRIDGE_CHAIN_1_BIND=:8080"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			environ: []string{"BRIDGE_CHAIN_1_PROXI=example.org:80"},
+			wantErr: true,
+		},
+		{
+			name:    "bad idle timeout",
+			environ: []string{"BRIDGE_PROXY=example.org:80", "BRIDGE_IDLE_TIMEOUT=1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadConfigWithEnv(tt.environ)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfigWithEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfigWithEnv() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/tailscale/hujson"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the encoding of a config file.
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatJSONC Format = "jsonc"
+	FormatYAML  Format = "yaml"
+)
+
+// Formats is all supported formats.
+var Formats = []Format{FormatJSON, FormatJSONC, FormatYAML}
+
+// ParseFormat returns the format by name.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "json":
+		return FormatJSON, nil
+	case "jsonc":
+		return FormatJSONC, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("unsupported config format %q", name)
+}
+
+// FormatFromPath returns the format by the extension of path, defaults to json.
+func FormatFromPath(path string) Format {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return FormatJSON
+	}
+	return format
+}
+
+// Unmarshal decodes data in the format into v.
+func Unmarshal(format Format, data []byte, v interface{}) error {
+	data, err := ToJSON(format, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ToJSON converts data in the format to standard JSON.
+func ToJSON(format Format, data []byte) ([]byte, error) {
+	switch format {
+	case FormatJSONC:
+		return hujson.Standardize(data)
+	case FormatYAML:
+		return yaml.YAMLToJSON(data)
+	}
+	return data, nil
+}
+
+// Marshal encodes v in the format.
+func Marshal(format Format, v interface{}) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(v)
+	case FormatJSON, FormatJSONC:
+		buf := bytes.NewBuffer(nil)
+		encoder := json.NewEncoder(buf)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported config format %q", format)
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	want := Config{
+		Chains: []Chain{
+			{
+				Bind:  []Node{{LB: []string{":8080"}}},
+				Proxy: []Node{{LB: []string{"example.org:80"}}, {LB: []string{"ssh://a:22", "ssh://b:22"}}},
+			},
+		},
+	}
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+	}{
+		{
+			name:   "json",
+			format: FormatJSON,
+			data:   `{"chains":[{"bind":[":8080"],"proxy":["example.org:80",{"lb":["ssh://a:22","ssh://b:22"]}]}]}`,
+		},
+		{
+			name:   "jsonc",
+			format: FormatJSONC,
+			data: `{
+  // port forward
+  "chains": [
+    {
+      "bind": [":8080"],
+      /* through the bastions */
+      "proxy": ["example.org:80", "ssh://a:22|ssh://b:22"],
+    },
+  ],
+}`,
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			data: `# port forward
+chains:
+- bind:
+  - ":8080"
+  proxy:
+  - example.org:80
+  - lb:
+    - ssh://a:22
+    - ssh://b:22
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Config{}
+			err := Unmarshal(tt.format, []byte(tt.data), &got)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal() got = %v, want %v", got, want)
+			}
+
+			data, err := Marshal(tt.format, got)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			again := Config{}
+			err = Unmarshal(tt.format, data, &again)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(again, want) {
+				t.Errorf("Unmarshal(Marshal()) got = %v, want %v", again, want)
+			}
+		})
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want Format
+	}{
+		{path: "bridge.json", want: FormatJSON},
+		{path: "bridge.jsonc", want: FormatJSONC},
+		{path: "bridge.yaml", want: FormatYAML},
+		{path: "/etc/bridge/bridge.YML", want: FormatYAML},
+		{path: "bridge", want: FormatJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := FormatFromPath(tt.path); got != tt.want {
+				t.Errorf("FormatFromPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
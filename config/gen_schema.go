@@ -0,0 +1,21 @@
+//go:build ignore
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/wzshiming/bridge/config"
+)
+
+func main() {
+	data, err := config.Marshal(config.FormatJSON, config.ConfigSchema())
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile("../schema.json", data, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
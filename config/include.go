@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wzshiming/bridge/logger"
+)
+
+// LoadOptions is the options for loading config files.
+type LoadOptions struct {
+	// Strict makes an unreadable file an error instead of skipping it.
+	Strict bool
+}
+
+// File is a config file that has been read.
+type File struct {
+	Path   string
+	Config Config
+}
+
+// ReadFiles reads the config files of the paths, globs or directories in order, following includes.
+func ReadFiles(opts LoadOptions, patterns ...string) ([]File, error) {
+	r := fileReader{
+		opts: opts,
+		seen: map[string]struct{}{},
+	}
+	err := r.readPatterns("", patterns)
+	if err != nil {
+		return nil, err
+	}
+	return r.files, nil
+}
+
+// Sources returns the config files of the patterns and the directories to watch.
+func Sources(patterns ...string) (files []string, dirs []string) {
+	r := fileReader{
+		quiet: true,
+		seen:  map[string]struct{}{},
+		dirs:  map[string]struct{}{},
+	}
+	_ = r.readPatterns("", patterns)
+	for _, file := range r.files {
+		files = append(files, file.Path)
+	}
+	for dir := range r.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return files, dirs
+}
+
+type fileReader struct {
+	opts  LoadOptions
+	quiet bool
+	seen  map[string]struct{}
+	files []File
+	dirs  map[string]struct{}
+}
+
+func (r *fileReader) skip(err error, path string) error {
+	if r.opts.Strict {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if !r.quiet {
+		logger.Std.Error("LoadConfig", "err", err, "path", path)
+	}
+	return nil
+}
+
+func (r *fileReader) readPatterns(dir string, patterns []string) error {
+	for _, pattern := range patterns {
+		if dir != "" && !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if r.dirs != nil {
+			r.dirs[patternDir(pattern)] = struct{}{}
+		}
+		paths, err := expandPattern(pattern)
+		if err != nil {
+			err = r.skip(err, pattern)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for _, path := range paths {
+			err := r.readFile(path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fileReader) readFile(path string) error {
+	key := path
+	if abs, err := filepath.Abs(path); err == nil {
+		key = abs
+	}
+	if _, ok := r.seen[key]; ok {
+		return nil
+	}
+	r.seen[key] = struct{}{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r.skip(err, path)
+	}
+	conf, err := parseConfig(FormatFromPath(path), data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	r.files = append(r.files, File{
+		Path:   path,
+		Config: conf,
+	})
+	return r.readPatterns(filepath.Dir(path), conf.Include)
+}
+
+// expandPattern returns the sorted files matched by the pattern.
+func expandPattern(pattern string) ([]string, error) {
+	if !hasMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return []string{pattern}, nil
+		}
+		return dirFiles(pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match")
+	}
+	var paths []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		paths = append(paths, match)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// patternDir returns the deepest directory of the pattern without meta characters.
+func patternDir(pattern string) string {
+	if !hasMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err == nil && info.IsDir() {
+			return pattern
+		}
+		return filepath.Dir(pattern)
+	}
+	dir := filepath.Dir(pattern)
+	for hasMeta(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// dirFiles returns the sorted config files in the directory.
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isConfigFile(entry.Name()) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func isConfigFile(name string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if ext == "" {
+		return false
+	}
+	_, err := ParseFormat(ext)
+	return err == nil
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
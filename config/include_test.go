@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadConfigWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"bridge.yaml": `
+include:
+- extra/*.json
+proxies:
+  bastion: ssh://bastion:22
+chains:
+- bind: [":1000"]
+  proxy: [a:80]
+`,
+		"extra/b.json":    `{"chains":[{"bind":[":1002"],"proxy":["b:80","@bastion"]}]}`,
+		"extra/a.json":    `{"chains":[{"bind":[":1001"],"proxy":["a:80"]}],"include":["../bridge.yaml"]}`,
+		"conf.d/20.jsonc": `{"chains":[{"bind":[":2002"],"proxy":["c:80"]}] /* second */}`,
+		"conf.d/10.yml":   "chains:\n- bind: [':2001']\n  proxy: [c:80]\n",
+		"conf.d/README":   "not a config",
+	})
+
+	tests := []struct {
+		name     string
+		opts     LoadOptions
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "include",
+			patterns: []string{filepath.Join(dir, "bridge.yaml")},
+			want:     []string{":1000", ":1001", ":1002"},
+		},
+		{
+			name:     "directory",
+			patterns: []string{filepath.Join(dir, "conf.d")},
+			want:     []string{":2001", ":2002"},
+		},
+		{
+			name:     "glob",
+			patterns: []string{filepath.Join(dir, "conf.d", "[0-9]*"), filepath.Join(dir, "extra", "a.json")},
+			want:     []string{":2001", ":2002", ":1001", ":1000", ":1002"},
+		},
+		{
+			name:     "skip unreadable",
+			patterns: []string{filepath.Join(dir, "missing.json"), filepath.Join(dir, "conf.d", "10.yml")},
+			want:     []string{":2001"},
+		},
+		{
+			name:     "strict",
+			opts:     LoadOptions{Strict: true},
+			patterns: []string{filepath.Join(dir, "missing.json"), filepath.Join(dir, "conf.d", "10.yml")},
+			wantErr:  true,
+		},
+		{
+			name:     "strict glob without match",
+			opts:     LoadOptions{Strict: true},
+			patterns: []string{filepath.Join(dir, "missing", "*.json")},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chains, err := LoadConfigWithOptions(tt.opts, tt.patterns...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfigWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := []string{}
+			for _, ch := range chains {
+				got = append(got, ch.Bind[0].LB[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfigWithOptions() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
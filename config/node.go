@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// The strategies to pick the member of a Node.
+const (
+	// StrategyRoundRobin picks the members in turn, it is the default.
+	StrategyRoundRobin = "round-robin"
+	StrategyRandom     = "random"
+	// StrategyWeighted picks the members in turn in proportion to the Weights.
+	StrategyWeighted = "weighted"
+	// StrategyLeastActive picks the member with the least active connections.
+	StrategyLeastActive = "least-active"
+	// StrategyLatency picks the member with the least moving average of the dial time.
+	StrategyLatency = "latency"
+	// StrategyHash picks the member by consistent hashing of the HashKey.
+	StrategyHash = "hash"
+)
+
+// Strategies is all supported strategies.
+var Strategies = []string{
+	StrategyRoundRobin,
+	StrategyRandom,
+	StrategyWeighted,
+	StrategyLeastActive,
+	StrategyLatency,
+	StrategyHash,
+}
+
+// The keys of StrategyHash.
+const (
+	// HashKeyClient hashes the address of the client, the target is used if it is unknown.
+	HashKeyClient = "client"
+	HashKeyTarget = "target"
+)
+
+// HealthCheck is the active health check of the members of a Node.
+type HealthCheck struct {
+	// Target is the address dialed through each member.
+	Target string `json:"target"`
+	// Interval between the probes, defaults to 10s.
+	Interval time.Duration `json:"interval,omitempty"`
+	// Timeout of each probe, defaults to 5s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Rise is the number of the consecutive successes to become healthy, defaults to 2.
+	Rise int `json:"rise,omitempty"`
+	// Fall is the number of the consecutive failures to become unhealthy, defaults to 3.
+	Fall int `json:"fall,omitempty"`
+}
+
+func (h HealthCheck) verify() error {
+	if h.Target == "" {
+		return fmt.Errorf("the target of the health check is required")
+	}
+	if h.Interval < 0 || h.Timeout < 0 || h.Rise < 0 || h.Fall < 0 {
+		return fmt.Errorf("the options of the health check must not be negative")
+	}
+	return nil
+}
+
+// The kinds of the errors for Retry.On.
+const (
+	// RetryOnTimeout is the timeout of the attempt or of the network.
+	RetryOnTimeout = "timeout"
+	RetryOnRefused = "refused"
+	// RetryOnReset is the connection reset or closed during the handshake.
+	RetryOnReset = "reset"
+	RetryOnDNS   = "dns"
+	// RetryOnAuth is the rejected credentials, such as the ssh password.
+	RetryOnAuth  = "auth"
+	RetryOnOther = "other"
+)
+
+// RetryOns is all kinds of the errors for Retry.On.
+var RetryOns = []string{
+	RetryOnTimeout,
+	RetryOnRefused,
+	RetryOnReset,
+	RetryOnDNS,
+	RetryOnAuth,
+	RetryOnOther,
+}
+
+// Retry is the policy of trying the members of a Node.
+type Retry struct {
+	// Attempts is the max number of the attempts, defaults to half of the members plus one.
+	Attempts int `json:"attempts,omitempty"`
+	// Timeout of each attempt, no limit by default.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Deadline of all attempts, no limit by default.
+	Deadline time.Duration `json:"deadline,omitempty"`
+	// Backoff is the delay before the second attempt, it is doubled before each next one.
+	Backoff time.Duration `json:"backoff,omitempty"`
+	// On is the kinds of the errors to retry, see the RetryOn constants, defaults to all but auth.
+	On []string `json:"on,omitempty"`
+}
+
+func (r Retry) verify() error {
+	if r.Attempts < 0 || r.Timeout < 0 || r.Deadline < 0 || r.Backoff < 0 {
+		return fmt.Errorf("the options of the retry must not be negative")
+	}
+	for _, on := range r.On {
+		if !slices.Contains(RetryOns, on) {
+			return fmt.Errorf("unsupported kind of error to retry %q", on)
+		}
+	}
+	return nil
+}
+
+// verify checks the options of the node, hop is false for the addresses that do not pick a member.
+func (m Node) verify(hop bool) error {
+	if !hop {
+		if m.HasOptions() {
+			return fmt.Errorf("the options are only supported by the proxies")
+		}
+		return nil
+	}
+
+	switch m.Strategy {
+	case "", StrategyRoundRobin, StrategyRandom, StrategyLeastActive, StrategyLatency:
+	case StrategyWeighted:
+		if len(m.Weights) != len(m.LB) {
+			return fmt.Errorf("got %d weights for %d members", len(m.Weights), len(m.LB))
+		}
+		for _, w := range m.Weights {
+			if w <= 0 {
+				return fmt.Errorf("the weights must be positive")
+			}
+		}
+	case StrategyHash:
+		switch m.HashKey {
+		case "", HashKeyClient, HashKeyTarget:
+		default:
+			return fmt.Errorf("unsupported hash key %q", m.HashKey)
+		}
+	default:
+		return fmt.Errorf("unsupported strategy %q", m.Strategy)
+	}
+	if len(m.Weights) != 0 && m.Strategy != StrategyWeighted {
+		return fmt.Errorf("the weights are only used by the %s strategy", StrategyWeighted)
+	}
+	if m.HashKey != "" && m.Strategy != StrategyHash {
+		return fmt.Errorf("the hash key is only used by the %s strategy", StrategyHash)
+	}
+	if m.HealthCheck != nil {
+		err := m.HealthCheck.verify()
+		if err != nil {
+			return err
+		}
+	}
+	if len(m.Priorities) != 0 {
+		if len(m.Priorities) != len(m.LB) {
+			return fmt.Errorf("got %d priorities for %d members", len(m.Priorities), len(m.LB))
+		}
+		for _, p := range m.Priorities {
+			if p < 0 {
+				return fmt.Errorf("the priorities must not be negative")
+			}
+		}
+	}
+	if m.Stagger < 0 {
+		return fmt.Errorf("the stagger must not be negative")
+	}
+	if m.Stagger != 0 && !m.Race {
+		return fmt.Errorf("the stagger is only used by the race")
+	}
+	if m.Retry != nil {
+		err := m.Retry.verify()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
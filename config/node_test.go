@@ -0,0 +1,102 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChainVerificationNode(t *testing.T) {
+	target := Node{LB: []string{"example.org:80"}}
+	tests := []struct {
+		name    string
+		node    Node
+		wantErr bool
+	}{
+		{
+			name: "default",
+			node: Node{LB: []string{"a", "b"}},
+		},
+		{
+			name: "weighted",
+			node: Node{LB: []string{"a", "b"}, Strategy: StrategyWeighted, Weights: []int{2, 1}},
+		},
+		{
+			name:    "weighted without weights",
+			node:    Node{LB: []string{"a", "b"}, Strategy: StrategyWeighted},
+			wantErr: true,
+		},
+		{
+			name:    "zero weight",
+			node:    Node{LB: []string{"a", "b"}, Strategy: StrategyWeighted, Weights: []int{1, 0}},
+			wantErr: true,
+		},
+		{
+			name:    "weights without weighted",
+			node:    Node{LB: []string{"a", "b"}, Weights: []int{1, 1}},
+			wantErr: true,
+		},
+		{
+			name: "hash client",
+			node: Node{LB: []string{"a", "b"}, Strategy: StrategyHash, HashKey: HashKeyClient},
+		},
+		{
+			name:    "unknown hash key",
+			node:    Node{LB: []string{"a", "b"}, Strategy: StrategyHash, HashKey: "port"},
+			wantErr: true,
+		},
+		{
+			name: "health check",
+			node: Node{LB: []string{"a", "b"}, HealthCheck: &HealthCheck{Target: "example.org:80", Rise: 1}},
+		},
+		{
+			name:    "health check without target",
+			node:    Node{LB: []string{"a", "b"}, HealthCheck: &HealthCheck{}},
+			wantErr: true,
+		},
+		{
+			name: "retry",
+			node: Node{LB: []string{"a", "b"}, Retry: &Retry{Attempts: 3, On: []string{RetryOnTimeout, RetryOnAuth}}},
+		},
+		{
+			name:    "retry on unknown error",
+			node:    Node{LB: []string{"a", "b"}, Retry: &Retry{On: []string{"eof"}}},
+			wantErr: true,
+		},
+		{
+			name: "race",
+			node: Node{LB: []string{"a", "b"}, Race: true, Stagger: time.Second},
+		},
+		{
+			name:    "stagger without race",
+			node:    Node{LB: []string{"a", "b"}, Stagger: time.Second},
+			wantErr: true,
+		},
+		{
+			name: "priorities",
+			node: Node{LB: []string{"a", "b", "c"}, Priorities: []int{0, 0, 1}},
+		},
+		{
+			name:    "priorities of the wrong length",
+			node:    Node{LB: []string{"a", "b", "c"}, Priorities: []int{0, 1}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown strategy",
+			node:    Node{LB: []string{"a", "b"}, Strategy: "fastest"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Chain{Proxy: []Node{target, tt.node}}.Verification()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verification() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	err := Chain{Proxy: []Node{{LB: target.LB, Strategy: StrategyRandom}}}.Verification()
+	if err == nil {
+		t.Errorf("Verification() of the target with a strategy succeeded, want error")
+	}
+}
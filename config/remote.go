@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IsRemote reports whether the config is a http(s) url.
+func IsRemote(config string) bool {
+	return strings.HasPrefix(config, "http://") || strings.HasPrefix(config, "https://")
+}
+
+// remoteTimeout is the timeout of fetching a config.
+const remoteTimeout = 30 * time.Second
+
+// Remote is a config fetched over http(s), the last good copy is cached on disk.
+type Remote struct {
+	URL    string
+	Client *http.Client
+	// Others are the other configs loaded with it, the fetched config can refer to their proxies.
+	Others []string
+
+	path string
+	meta remoteMeta
+}
+
+type remoteMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// NewRemote returns a Remote that caches the config in the cacheDir.
+func NewRemote(rawURL string, cacheDir string) (*Remote, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	// Keep the extension for the format.
+	name := hex.EncodeToString(sum[:8]) + path.Ext(u.Path)
+	r := &Remote{
+		URL:    rawURL,
+		Client: &http.Client{Timeout: remoteTimeout},
+		path:   filepath.Join(cacheDir, name),
+	}
+
+	// The cached copy is only used with its validators.
+	if _, err := os.Stat(r.path); err == nil {
+		data, err := os.ReadFile(r.metaPath())
+		if err == nil {
+			_ = json.Unmarshal(data, &r.meta)
+		}
+	}
+	return r, nil
+}
+
+// Path returns the path of the cached copy.
+func (r *Remote) Path() string {
+	return r.path
+}
+
+func (r *Remote) metaPath() string {
+	return r.path + ".meta"
+}
+
+// Fetch fetches the config, and updates the cached copy if it is changed and valid.
+func (r *Remote) Fetch(ctx context.Context) (changed bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	if r.meta.ETag != "" {
+		req.Header.Set("If-None-Match", r.meta.ETag)
+	}
+	if r.meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", r.meta.LastModified)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("fetch %s: unexpected status %s", r.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	// Do not replace the last good copy with a broken one.
+	conf, err := parseConfig(FormatFromPath(r.path), data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", r.URL, err)
+	}
+	file := File{Path: r.URL, Config: conf}
+	others, err := r.otherFiles()
+	if err != nil {
+		return false, err
+	}
+	proxies, err := MergeProxies(append(others, file))
+	if err != nil {
+		return false, err
+	}
+	_, err = file.chains(proxies)
+	if err != nil {
+		return false, err
+	}
+
+	old, _ := os.ReadFile(r.path)
+	changed = string(old) != string(data)
+	if changed {
+		err = writeFileAtomic(r.path, data)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	r.meta = remoteMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	meta, err := json.Marshal(r.meta)
+	if err != nil {
+		return false, err
+	}
+	err = writeFileAtomic(r.metaPath(), meta)
+	if err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// otherFiles reads the other configs, the cached copy is replaced by the fetched one.
+func (r *Remote) otherFiles() ([]File, error) {
+	reader := fileReader{
+		quiet: true,
+		seen:  map[string]struct{}{},
+	}
+	key := r.path
+	if abs, err := filepath.Abs(r.path); err == nil {
+		key = abs
+	}
+	reader.seen[key] = struct{}{}
+	err := reader.readPatterns("", r.Others)
+	if err != nil {
+		return nil, err
+	}
+	return reader.files, nil
+}
+
+// Poll fetches the config at the interval until the ctx is done, and calls onChange when it is changed.
+func (r *Remote) Poll(ctx context.Context, log *slog.Logger, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := r.Fetch(ctx)
+		if err != nil {
+			log.Error("Fetch config", "err", err, "url", r.URL)
+			continue
+		}
+		if changed {
+			log.Info("Config changed", "url", r.URL)
+			onChange()
+		}
+	}
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRemoteFetch(t *testing.T) {
+	var mut sync.Mutex
+	body := `{"chains":[{"bind":[":8080"],"proxy":["example.com:80"]}]}`
+	etag := `"1"`
+	down := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	set := func(b, e string, d bool) {
+		mut.Lock()
+		defer mut.Unlock()
+		body, etag, down = b, e, d
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	r, err := NewRemote(srv.URL+"/bridge.json", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		body    string
+		etag    string
+		down    bool
+		changed bool
+		wantErr bool
+		want    string
+	}{
+		{name: "first", body: body, etag: etag, changed: true, want: "example.com:80"},
+		{name: "not modified", body: body, etag: etag, want: "example.com:80"},
+		{name: "modified", body: `{"chains":[{"bind":[":8080"],"proxy":["example.org:80"]}]}`, etag: `"2"`, changed: true, want: "example.org:80"},
+		{name: "invalid", body: `{"chains":`, etag: `"3"`, wantErr: true, want: "example.org:80"},
+		{name: "unresolved", body: `{"chains":[{"bind":[":8080"],"proxy":["example.net:80","@undefined"]}]}`, etag: `"4"`, wantErr: true, want: "example.org:80"},
+		{name: "unverified", body: `{"chains":[{"bind":[":8080"]}]}`, etag: `"5"`, wantErr: true, want: "example.org:80"},
+		{name: "relative list", body: `{"chains":[{"bind":[":8080"],"proxy":["example.net:80"],"allow":["list:allow.txt"]}]}`, etag: `"6"`, wantErr: true, want: "example.org:80"},
+		{name: "down", down: true, wantErr: true, want: "example.org:80"},
+	}
+	for _, step := range steps {
+		set(step.body, step.etag, step.down)
+		changed, err := r.Fetch(ctx)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: Fetch() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if changed != step.changed {
+			t.Errorf("%s: Fetch() changed = %v, want %v", step.name, changed, step.changed)
+		}
+		// The last good copy is kept.
+		chains, err := LoadConfig(r.Path())
+		if err != nil {
+			t.Fatalf("%s: LoadConfig() error = %v", step.name, err)
+		}
+		if got := chains[0].Proxy[0].LB[0]; got != step.want {
+			t.Errorf("%s: proxy = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	// The validators are restored from the cache.
+	set(`{"chains":[{"bind":[":8080"],"proxy":["example.org:80"]}]}`, `"2"`, false)
+	r, err = NewRemote(srv.URL+"/bridge.json", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := r.Fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("Fetch() after restart changed = true, want false")
+	}
+}
+
+func TestRemoteFetchOthers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"chains":[{"bind":[":8080"],"proxy":["example.com:80","@shared"]}]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "proxies.json")
+	err := os.WriteFile(local, []byte(`{"proxies":{"shared":"socks5://127.0.0.1:1080"},"chains":[]}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRemote(srv.URL+"/bridge.json", filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The proxy of another config is undefined on its own.
+	_, err = r.Fetch(context.Background())
+	if err == nil {
+		t.Fatalf("Fetch() without the other configs = nil, want an error")
+	}
+
+	r.Others = []string{local, r.Path()}
+	changed, err := r.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("Fetch() changed = false, want true")
+	}
+	chains, err := LoadConfig(local, r.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chains[0].Proxy[1].LB[0]; got != "socks5://127.0.0.1:1080" {
+		t.Errorf("proxy = %q, want the shared one", got)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/wzshiming/bridge/internal/route"
+)
+
+// The routes of a Rule other than the Routes of the chain.
+const (
+	// RouteDirect dials the destination directly.
+	RouteDirect = "direct"
+	// RouteReject refuses the destination.
+	RouteReject = "reject"
+)
+
+// Rule routes the destinations it matches, the rule without conditions matches all.
+type Rule struct {
+	// Domain is the domain suffix, "corp" matches "corp" and "a.corp".
+	Domain []string `json:"domain,omitempty"`
+	// Keyword is the substring of the domain.
+	Keyword []string `json:"keyword,omitempty"`
+	// Regex is the regular expression of the domain.
+	Regex []string `json:"regex,omitempty"`
+	// CIDR is the range of the IP, the domains are not resolved to match it.
+	CIDR []string `json:"cidr,omitempty"`
+	// Port is the port or the range of the ports, such as "443" or "8000-9000".
+	Port []string `json:"port,omitempty"`
+	// Network is tcp or unix.
+	Network []string `json:"network,omitempty"`
+
+	// Route is the name of the Routes of the chain, RouteDirect or RouteReject.
+	Route string `json:"route"`
+}
+
+// Conditions returns the conditions of the rule.
+func (r Rule) Conditions() route.Conditions {
+	return route.Conditions{
+		Domain:  r.Domain,
+		Keyword: r.Keyword,
+		Regex:   r.Regex,
+		CIDR:    r.CIDR,
+		Port:    r.Port,
+		Network: r.Network,
+	}
+}
+
+func (r Rule) verify(routes map[string][]Node) error {
+	switch r.Route {
+	case "":
+		return fmt.Errorf("the route is required")
+	case RouteDirect, RouteReject:
+	default:
+		if _, ok := routes[r.Route]; !ok {
+			return fmt.Errorf("undefined route %q", r.Route)
+		}
+	}
+	_, err := route.NewMatcher(r.Conditions())
+	return err
+}
+
+// ResolveLists returns the chain with the relative list: sources joined to the dir of its file.
+func (c Chain) ResolveLists(path string) Chain {
+	if path == "" || IsRemote(path) {
+		return c
+	}
+	dir := filepath.Dir(path)
+	c.Allow = resolveLists(dir, c.Allow)
+	if c.Rules != nil {
+		rules := make([]Rule, 0, len(c.Rules))
+		for _, r := range c.Rules {
+			r.Domain = resolveLists(dir, r.Domain)
+			r.CIDR = resolveLists(dir, r.CIDR)
+			rules = append(rules, r)
+		}
+		c.Rules = rules
+	}
+	return c
+}
+
+// relativeLists returns the list: sources with relative paths.
+func (c Chain) relativeLists() []string {
+	var lists []string
+	values := slices.Clone(c.Allow)
+	for _, r := range c.Rules {
+		values = append(values, r.Domain...)
+		values = append(values, r.CIDR...)
+	}
+	for _, value := range values {
+		if path, ok := route.IsList(value); ok && !filepath.IsAbs(path) {
+			lists = append(lists, value)
+		}
+	}
+	return lists
+}
+
+func resolveLists(dir string, values []string) []string {
+	var out []string
+	for i, value := range values {
+		path, ok := route.IsList(value)
+		if !ok || filepath.IsAbs(path) {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(values)
+		}
+		out[i] = route.ListPrefix + filepath.Join(dir, path)
+	}
+	if out == nil {
+		return values
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChainVerificationRule(t *testing.T) {
+	proxy := []Node{{LB: []string{"-"}}}
+	routes := map[string][]Node{"corp": {{LB: []string{"ssh://bastion:22"}}}}
+	tests := []struct {
+		name    string
+		chain   Chain
+		wantErr bool
+	}{
+		{
+			name: "route",
+			chain: Chain{Proxy: proxy, Routes: routes, Rules: []Rule{
+				{Domain: []string{"corp"}, Route: "corp"},
+				{CIDR: []string{"10.0.0.0/8"}, Route: RouteReject},
+				{Route: RouteDirect},
+			}},
+		},
+		{
+			name:    "undefined route",
+			chain:   Chain{Proxy: proxy, Rules: []Rule{{Domain: []string{"corp"}, Route: "corp"}}},
+			wantErr: true,
+		},
+		{
+			name:    "without route",
+			chain:   Chain{Proxy: proxy, Rules: []Rule{{Domain: []string{"corp"}}}},
+			wantErr: true,
+		},
+		{
+			name:  "single ip",
+			chain: Chain{Proxy: proxy, Rules: []Rule{{CIDR: []string{"10.0.0.1"}, Route: RouteDirect}}},
+		},
+		{
+			name:    "invalid cidr",
+			chain:   Chain{Proxy: proxy, Rules: []Rule{{CIDR: []string{"10.0.0.0/40"}, Route: RouteDirect}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			chain:   Chain{Proxy: proxy, Rules: []Rule{{Port: []string{"1-"}, Route: RouteDirect}}},
+			wantErr: true,
+		},
+		{
+			name:    "reserved route",
+			chain:   Chain{Proxy: proxy, Routes: map[string][]Node{RouteDirect: nil}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.chain.Verification()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verification() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChainResolveLists(t *testing.T) {
+	chain := Chain{
+		Allow: []string{"list:allow.txt", "example.com"},
+		Rules: []Rule{{Domain: []string{"list:/etc/corp.txt", "list:lists/corp.txt"}, CIDR: []string{"list:../cidr.txt"}}},
+	}
+	tests := []struct {
+		name string
+		path string
+		want Chain
+	}{
+		{
+			name: "file",
+			path: "conf/bridge.yaml",
+			want: Chain{
+				Allow: []string{"list:" + filepath.Join("conf", "allow.txt"), "example.com"},
+				Rules: []Rule{{Domain: []string{"list:/etc/corp.txt", "list:" + filepath.Join("conf", "lists", "corp.txt")}, CIDR: []string{"list:cidr.txt"}}},
+			},
+		},
+		{
+			name: "remote",
+			path: "https://example.com/bridge.yaml",
+			want: chain,
+		},
+		{
+			name: "args",
+			want: chain,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chain.ResolveLists(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveLists() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if chain.Allow[0] != "list:allow.txt" {
+		t.Errorf("the chain is changed: %v", chain.Allow)
+	}
+}
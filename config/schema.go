@@ -0,0 +1,318 @@
+package config
+
+//go:generate go run gen_schema.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema, only the keywords used by the config are supported.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 schemaType         `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+
+	// never is the false schema that matches nothing.
+	never bool
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	nodeType     = reflect.TypeOf(Node{})
+)
+
+// ConfigSchema returns the JSON Schema of Config generated from the Go types.
+func ConfigSchema() *Schema {
+	g := schemaGenerator{
+		defs: map[string]*Schema{},
+	}
+	root := g.generate(reflect.TypeOf(Config{}))
+	return &Schema{
+		Schema: "https://json-schema.org/draft/2020-12/schema",
+		Ref:    root.Ref,
+		Defs:   g.defs,
+	}
+}
+
+type schemaGenerator struct {
+	defs map[string]*Schema
+}
+
+func (g *schemaGenerator) generate(t reflect.Type) *Schema {
+	switch {
+	case t == durationType:
+		return &Schema{
+			Type:        schemaType{"integer"},
+			Description: "Duration in nanoseconds.",
+		}
+	case t == nodeType:
+		return g.define(t, func() *Schema {
+			return &Schema{
+				Description: `Addresses to choose from, a string separated by "|", a list, or an object.`,
+				OneOf: []*Schema{
+					{Type: schemaType{"string"}},
+					{Type: schemaType{"array"}, Items: &Schema{Type: schemaType{"string"}}},
+					g.object(t),
+				},
+			}
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.generate(t.Elem())
+		if s.Ref != "" {
+			return &Schema{OneOf: []*Schema{s, {Type: schemaType{"null"}}}}
+		}
+		if len(s.Type) == 0 {
+			return s
+		}
+		s.Type = append(s.Type, "null")
+		return s
+	case reflect.String:
+		return &Schema{Type: schemaType{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: schemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: schemaType{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: schemaType{"number"}}
+	case reflect.Slice:
+		return &Schema{Type: schemaType{"array", "null"}, Items: g.generate(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: schemaType{"object", "null"}, AdditionalProperties: g.generate(t.Elem())}
+	case reflect.Struct:
+		return g.define(t, func() *Schema {
+			return g.object(t)
+		})
+	}
+	panic(fmt.Sprintf("config: unsupported type %s in schema", t))
+}
+
+// define adds the named type to the definitions, and returns the reference to it.
+func (g *schemaGenerator) define(t reflect.Type, fn func() *Schema) *Schema {
+	ref := &Schema{Ref: "#/$defs/" + t.Name()}
+	if _, ok := g.defs[t.Name()]; !ok {
+		// Mark it first for the recursive types.
+		g.defs[t.Name()] = nil
+		g.defs[t.Name()] = fn()
+	}
+	return ref
+}
+
+func (g *schemaGenerator) object(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:                 schemaType{"object"},
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: &Schema{never: true},
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = g.generate(field.Type)
+	}
+	return s
+}
+
+// schemaType is the type keyword, a single type is encoded as a string.
+type schemaType []string
+
+func (t schemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.never {
+		return []byte("false"), nil
+	}
+	type schema Schema
+	return json.Marshal((*schema)(s))
+}
+
+// Validate checks the decoded JSON value against the schema, the numbers must be json.Number.
+func (s *Schema) Validate(v any) error {
+	return s.validate(s, "", v)
+}
+
+func (s *Schema) validate(root *Schema, path string, v any) error {
+	if s.never {
+		return fmt.Errorf("%s: is not allowed", showPath(path))
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		def := root.Defs[name]
+		if !ok || def == nil {
+			return fmt.Errorf("%s: unknown reference %q", showPath(path), s.Ref)
+		}
+		return def.validate(root, path, v)
+	}
+	if len(s.OneOf) != 0 {
+		return s.validateOneOf(root, path, v)
+	}
+
+	typ := jsonType(v)
+	if len(s.Type) != 0 && !matchType(s.Type, typ) {
+		return fmt.Errorf("%s: got %s, want %s", showPath(path), typ, strings.Join(s.Type, " or "))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sub := s.Properties[key]
+			if sub == nil {
+				sub = s.AdditionalProperties
+			}
+			if sub == nil {
+				continue
+			}
+			if sub.never {
+				return fmt.Errorf("%s: unknown key %q", showPath(path), key)
+			}
+			err := sub.validate(root, joinPath(path, key), v[key])
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range v {
+			err := s.Items.validate(root, fmt.Sprintf("%s[%d]", path, i), item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateOneOf(root *Schema, path string, v any) error {
+	var matched int
+	var typeErr error
+	for _, sub := range s.OneOf {
+		err := sub.validate(root, path, v)
+		if err == nil {
+			matched++
+			continue
+		}
+		// Report the error of the alternative of the same type.
+		if typeErr == nil && matchType(sub.Type, jsonType(v)) {
+			typeErr = err
+		}
+	}
+	switch {
+	case matched == 1:
+		return nil
+	case matched > 1:
+		return fmt.Errorf("%s: matches more than one alternative", showPath(path))
+	case typeErr != nil:
+		return typeErr
+	}
+	var types []string
+	for _, sub := range s.OneOf {
+		types = append(types, sub.Type...)
+	}
+	return fmt.Errorf("%s: got %s, want %s", showPath(path), jsonType(v), strings.Join(types, " or "))
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func matchType(types schemaType, typ string) bool {
+	for _, t := range types {
+		if t == typ || (t == "number" && typ == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func showPath(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
+
+// parseConfig decodes the config in the format, and checks it against the schema.
+func parseConfig(format Format, data []byte) (Config, error) {
+	data, err := ToJSON(format, data)
+	if err != nil {
+		return Config{}, err
+	}
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&v)
+	if err != nil {
+		return Config{}, err
+	}
+	err = configSchema.Validate(v)
+	if err != nil {
+		return Config{}, err
+	}
+	conf := Config{}
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return Config{}, err
+	}
+	return conf, nil
+}
+
+var configSchema = ConfigSchema()
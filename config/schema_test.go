@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	want, err := Marshal(FormatJSON, ConfigSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("schema.json is out of date, run go generate ./config")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		data    string
+		wantErr string
+	}{
+		{
+			name:   "node forms",
+			format: FormatJSON,
+			data:   `{"$schema":"../schema.json","proxies":{"a":{"lb":["x:1","y:1"]}},"chains":[{"bind":[":8080"],"proxy":["x:1|y:1",["x:1","y:1"],{"lb":["x:1"]}],"idle_timeout":1000000000,"labels":{"team":"infra"},"allow":null}]}`,
+		},
+		{
+			name:   "null pointers",
+			format: FormatJSON,
+			data:   `{"chains":[{"proxy":[{"lb":["x:1"],"health_check":null}],"retry":null,"debug":null}]}`,
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			data:   "chains:\n- bind: [':8080']\n  proxy: ['example.org:80']\n  debug: true\n",
+		},
+		{
+			name:    "misspelled key",
+			format:  FormatJSON,
+			data:    `{"chains":[{"proxy":["example.org:80"],"idel_timeout":1}]}`,
+			wantErr: `chains[0]: unknown key "idel_timeout"`,
+		},
+		{
+			name:    "unknown node key",
+			format:  FormatJSON,
+			data:    `{"chains":[{"proxy":[{"lb":["example.org:80"],"weight":1}]}]}`,
+			wantErr: `chains[0].proxy[0]: unknown key "weight"`,
+		},
+		{
+			name:    "duration string",
+			format:  FormatYAML,
+			data:    "chains:\n- proxy: ['example.org:80']\n  idle_timeout: 1m\n",
+			wantErr: "chains[0].idle_timeout: got string, want integer",
+		},
+		{
+			name:    "node number",
+			format:  FormatJSON,
+			data:    `{"chains":[{"proxy":[80]}]}`,
+			wantErr: "chains[0].proxy[0]: got integer, want string or array or object",
+		},
+		{
+			name:    "unknown top level key",
+			format:  FormatJSON,
+			data:    `{"chain":[]}`,
+			wantErr: `config: unknown key "chain"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(tt.format, []byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ go 1.25.0
 
 require (
 	github.com/Microsoft/go-winio v0.6.2
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/golang/snappy v1.0.0
 	github.com/spf13/pflag v1.0.10
+	github.com/tailscale/hujson v0.0.0-20250605163823-992244df8c5a
 	github.com/wzshiming/anyproxy v0.8.0
 	github.com/wzshiming/cmux v0.4.2
 	github.com/wzshiming/commandproxy v0.2.1
@@ -17,6 +19,7 @@ require (
 	github.com/wzshiming/socks4 v0.4.0
 	github.com/wzshiming/socks5 v0.7.0
 	github.com/wzshiming/sshproxy v0.6.0
+	sigs.k8s.io/yaml v1.6.0
 )
 
 require (
@@ -24,6 +27,7 @@ require (
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/wzshiming/sshd v0.2.5 // indirect
 	github.com/wzshiming/trie v0.3.1 // indirect
+	go.yaml.in/yaml/v2 v2.4.2 // indirect
 	golang.org/x/crypto v0.52.0 // indirect
 	golang.org/x/net v0.55.0 // indirect
 	golang.org/x/sync v0.20.0 // indirect
@@ -0,0 +1,214 @@
+package expand
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/wzshiming/commandproxy"
+)
+
+var expanders = map[string]func(ctx context.Context, arg string) (string, error){
+	"env":  expandEnv,
+	"file": expandFile,
+	"exec": expandExec,
+}
+
+// Expand replaces the placeholders in s with their values.
+// The placeholders are ${env:NAME}, ${file:/path/to/file} and ${exec:command args...},
+// the trailing newline of file contents and command outputs is trimmed.
+func Expand(ctx context.Context, s string) (string, error) {
+	return replace(s, func(kind, arg string) (string, error) {
+		return expanders[kind](ctx, arg)
+	})
+}
+
+// Redact replaces the placeholders in s with repl without evaluating them.
+func Redact(s string, repl string) (string, error) {
+	return replace(s, func(kind, arg string) (string, error) {
+		return repl, nil
+	})
+}
+
+// placeholder is the byte that stands for a placeholder in the template, it is not valid in a url.
+const placeholder = "\x00"
+
+func replace(s string, fun func(kind, arg string) (string, error)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	if strings.Contains(s, placeholder) {
+		return "", fmt.Errorf("invalid NUL character in %q", s)
+	}
+	// The template is s with each placeholder as one byte.
+	var template strings.Builder
+	var values []string
+	for {
+		start := strings.Index(s, "${")
+		if start == -1 {
+			template.WriteString(s)
+			break
+		}
+		template.WriteString(s[:start])
+		s = s[start:]
+
+		kind, rest, ok := strings.Cut(s[2:], ":")
+		if !ok || expanders[kind] == nil {
+			template.WriteString("${")
+			s = s[2:]
+			continue
+		}
+		end := closing(kind, rest)
+		if end == -1 {
+			return "", fmt.Errorf("unclosed placeholder ${%s:", kind)
+		}
+		arg := rest[:end]
+		rest = rest[end+1:]
+		val, err := fun(kind, arg)
+		if err != nil {
+			return "", err
+		}
+		template.WriteString(placeholder)
+		values = append(values, val)
+		s = rest
+	}
+
+	t := template.String()
+	var buf strings.Builder
+	offset := 0
+	for _, val := range values {
+		i := offset + strings.Index(t[offset:], placeholder)
+		buf.WriteString(t[offset:i])
+		if escape := escaper(t, i); escape != nil {
+			val = escape(val)
+		}
+		buf.WriteString(val)
+		offset = i + len(placeholder)
+	}
+	buf.WriteString(t[offset:])
+	return buf.String(), nil
+}
+
+// closing returns the index of the } that closes the argument of the placeholder, -1 if it is not closed.
+func closing(kind, arg string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case kind == "exec" && (c == '\'' || c == '"'):
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// Split splits s by sep, except for the sep inside the placeholders.
+func Split(s, sep string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "${") {
+			kind, rest, ok := strings.Cut(s[i+2:], ":")
+			if ok && expanders[kind] != nil {
+				if end := closing(kind, rest); end != -1 {
+					i += 2 + len(kind) + 1 + end + 1
+					continue
+				}
+			}
+		}
+		if strings.HasPrefix(s[i:], sep) {
+			out = append(out, s[start:i])
+			i += len(sep)
+			start = i
+			continue
+		}
+		i++
+	}
+	return append(out, s[start:])
+}
+
+// escaper returns the escaping of the value at the offset of the template, nil if it is not escaped.
+func escaper(template string, offset int) func(string) string {
+	_, rest, ok := strings.Cut(template, "://")
+	if !ok {
+		return nil
+	}
+	start := len(template) - len(rest)
+	if offset < start {
+		return nil
+	}
+	offset -= start
+	end := strings.IndexAny(rest, "/?#")
+	if end == -1 {
+		end = len(rest)
+	}
+	if at := strings.LastIndex(rest[:end], "@"); offset < at {
+		return func(s string) string {
+			return url.User(s).String()
+		}
+	}
+	query := strings.Index(rest, "?")
+	if query == -1 || offset < query {
+		return nil
+	}
+	if fragment := strings.Index(rest, "#"); fragment != -1 && offset > fragment {
+		return nil
+	}
+	return url.QueryEscape
+}
+
+func expandEnv(ctx context.Context, name string) (string, error) {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", name)
+	}
+	return val, nil
+}
+
+func expandFile(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return trimNewline(string(data)), nil
+}
+
+func expandExec(ctx context.Context, command string) (string, error) {
+	args, err := commandproxy.SplitCommand(command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("exec %q: %w: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return trimNewline(string(out)), nil
+}
+
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+	return s
+}
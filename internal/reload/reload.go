@@ -0,0 +1,191 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/wzshiming/bridge/chain"
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/internal/scheme"
+)
+
+// Task is a running chain.
+type Task struct {
+	Config config.Chain
+	// Wait waits for the chain to be ready.
+	Wait func(ctx context.Context, probe bool) error
+	// Update swaps the dial side of the chain, and keeps its listeners.
+	Update func(ctx context.Context, task config.Chain) error
+	// Stop stops the chain and waits for its listeners to be closed.
+	Stop func()
+}
+
+// Reloader applies the reloaded chains, the failed ones are rolled back.
+type Reloader struct {
+	// Start starts the chain until the ctx is done.
+	Start func(ctx context.Context, log *slog.Logger, task config.Chain) *Task
+
+	working map[string]*Task
+}
+
+// Reload applies the tasks, initial is true for the first start that has nothing to roll back to.
+func (r *Reloader) Reload(ctx context.Context, log *slog.Logger, tasks []config.Chain, initial bool) {
+	working := map[string]*Task{}
+	var pending []config.Chain
+	var added, updated, removed, kept, failed, disabled int
+	for _, task := range tasks {
+		if task.Disabled {
+			disabled++
+			chain.WithChain(log, task).Info("Reload", "status", "disabled", "chain", showChain(task))
+			continue
+		}
+		uniq := task.Unique()
+		if _, ok := working[uniq]; ok {
+			continue
+		}
+		if t := r.working[uniq]; t != nil {
+			working[uniq] = t
+			kept++
+			log.Info("Reload", "status", "kept", "chain", showChain(task))
+			continue
+		}
+		working[uniq] = nil
+		pending = append(pending, task)
+	}
+
+	stale := map[string]*Task{}
+	for uniq, t := range r.working {
+		if _, ok := working[uniq]; !ok {
+			stale[uniq] = t
+		}
+	}
+
+	for _, task := range pending {
+		uniq := task.Unique()
+
+		// Only the dial side is changed, keep the listeners.
+		if u, t := sameListen(stale, task); t != nil {
+			err := t.Update(ctx, task)
+			if err == nil {
+				t.Config = task
+				delete(stale, u)
+				working[uniq] = t
+				updated++
+				log.Info("Reload", "status", "updated", "chain", showChain(task))
+				continue
+			}
+			if !errors.Is(err, chain.ErrNotRunning) {
+				delete(stale, u)
+				delete(working, uniq)
+				working[u] = t
+				failed++
+				log.Error("Reload", "status", "failed", "err", err, "chain", showChain(task))
+				continue
+			}
+		}
+
+		// The removed tasks that listen on the same addresses must release them first.
+		var replaced, moved []string
+		for u, t := range stale {
+			switch {
+			case conflict(t.Config, task):
+				replaced = append(replaced, u)
+				t.Stop()
+			case task.Name != "" && t.Config.Name == task.Name:
+				moved = append(moved, u)
+			}
+		}
+
+		t := r.Start(ctx, log, task)
+		err := t.Wait(ctx, !initial)
+		if err == nil {
+			working[uniq] = t
+			added++
+			log.Info("Reload", "status", "added", "chain", showChain(task))
+			for _, u := range replaced {
+				old := stale[u]
+				delete(stale, u)
+				removed++
+				log.Info("Reload", "status", "removed", "chain", showChain(old.Config))
+			}
+			for _, u := range moved {
+				old := stale[u]
+				delete(stale, u)
+				old.Stop()
+				removed++
+				log.Info("Reload", "status", "removed", "chain", showChain(old.Config))
+			}
+			continue
+		}
+
+		failed++
+		if initial {
+			// There is nothing to roll back to, keep retrying.
+			working[uniq] = t
+			log.Error("Reload", "status", "failed", "err", err, "chain", showChain(task))
+			continue
+		}
+
+		t.Stop()
+		delete(working, uniq)
+		log.Error("Reload", "status", "failed", "err", err, "chain", showChain(task))
+		for _, u := range replaced {
+			old := stale[u]
+			delete(stale, u)
+			working[u] = r.Start(ctx, log, old.Config)
+			log.Warn("Reload", "status", "rollback", "chain", showChain(old.Config))
+		}
+		for _, u := range moved {
+			old := stale[u]
+			delete(stale, u)
+			working[u] = old
+			log.Warn("Reload", "status", "rollback", "chain", showChain(old.Config))
+		}
+	}
+
+	for _, t := range stale {
+		t.Stop()
+		removed++
+		log.Info("Reload", "status", "removed", "chain", showChain(t.Config))
+	}
+
+	log.Info("Reload summary", "added", added, "updated", updated, "removed", removed, "kept", kept, "failed", failed, "disabled", disabled)
+	r.working = working
+}
+
+func showChain(task config.Chain) string {
+	return strings.TrimSpace(chain.ShowChainWithConfig(task))
+}
+
+// sameListen returns the task that has the same listen side as the new one.
+func sameListen(tasks map[string]*Task, task config.Chain) (string, *Task) {
+	if len(task.Bind) == 0 {
+		return "", nil
+	}
+	listenUnique := task.ListenUnique()
+	for uniq, t := range tasks {
+		if t.Config.ListenUnique() == listenUnique {
+			return uniq, t
+		}
+	}
+	return "", nil
+}
+
+// conflict reports whether the tasks listen on the same address.
+func conflict(a, b config.Chain) bool {
+	if len(a.Bind) == 0 || len(b.Bind) == 0 {
+		return false
+	}
+	for _, x := range a.Bind[0].LB {
+		_, x, _ := scheme.SplitSchemeAddr(x)
+		for _, y := range b.Bind[0].LB {
+			_, y, _ := scheme.SplitSchemeAddr(y)
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/wzshiming/bridge/config"
+	"github.com/wzshiming/bridge/logger"
+)
+
+type fakeChains struct {
+	events    []string
+	waitErr   map[string]error
+	updateErr error
+}
+
+func (f *fakeChains) start(ctx context.Context, log *slog.Logger, task config.Chain) *Task {
+	name := task.Name + ">" + task.Proxy[0].LB[0]
+	f.events = append(f.events, "start "+name)
+	return &Task{
+		Config: task,
+		Wait: func(ctx context.Context, probe bool) error {
+			return f.waitErr[name]
+		},
+		Update: func(ctx context.Context, task config.Chain) error {
+			f.events = append(f.events, "update "+task.Name+">"+task.Proxy[0].LB[0])
+			return f.updateErr
+		},
+		Stop: func() {
+			f.events = append(f.events, "stop "+name)
+		},
+	}
+}
+
+func (f *fakeChains) take() []string {
+	events := f.events
+	f.events = nil
+	return events
+}
+
+func newChain(name, bind, proxy string) config.Chain {
+	return config.Chain{
+		Name:  name,
+		Bind:  []config.Node{{LB: []string{bind}}},
+		Proxy: []config.Node{{LB: []string{proxy}}},
+	}
+}
+
+func TestReload(t *testing.T) {
+	a := newChain("a", ":1000", "a1:80")
+	b := newChain("b", ":2000", "b1:80")
+	c := newChain("c", ":3000", "c1:80")
+
+	tests := []struct {
+		name      string
+		tasks     []config.Chain
+		waitErr   map[string]error
+		updateErr error
+		want      []string
+		working   []string
+	}{
+		{
+			name:    "kept",
+			tasks:   []config.Chain{a, b},
+			want:    nil,
+			working: []string{"a>a1:80", "b>b1:80"},
+		},
+		{
+			name:    "added and removed",
+			tasks:   []config.Chain{a, c},
+			want:    []string{"start c>c1:80", "stop b>b1:80"},
+			working: []string{"a>a1:80", "c>c1:80"},
+		},
+		{
+			name:    "updated",
+			tasks:   []config.Chain{newChain("a", ":1000", "a2:80"), b},
+			want:    []string{"update a>a2:80"},
+			working: []string{"a>a2:80", "b>b1:80"},
+		},
+		{
+			name:      "update failed",
+			tasks:     []config.Chain{newChain("a", ":1000", "a2:80"), b},
+			updateErr: errors.New("unreachable"),
+			want:      []string{"update a>a2:80"},
+			working:   []string{"a>a1:80", "b>b1:80"},
+		},
+		{
+			name:    "replaced",
+			tasks:   []config.Chain{newChain("x", ":1000", "x1:80"), b},
+			want:    []string{"stop a>a1:80", "start x>x1:80"},
+			working: []string{"b>b1:80", "x>x1:80"},
+		},
+		{
+			name:    "replaced rollback",
+			tasks:   []config.Chain{newChain("x", ":1000", "x1:80"), b},
+			waitErr: map[string]error{"x>x1:80": errors.New("unreachable")},
+			want:    []string{"stop a>a1:80", "start x>x1:80", "stop x>x1:80", "start a>a1:80"},
+			working: []string{"a>a1:80", "b>b1:80"},
+		},
+		{
+			name:    "moved",
+			tasks:   []config.Chain{newChain("a", ":1001", "a1:80"), b},
+			want:    []string{"start a>a1:80", "stop a>a1:80"},
+			working: []string{"a>a1:80", "b>b1:80"},
+		},
+		{
+			name:    "moved rollback",
+			tasks:   []config.Chain{newChain("a", ":1001", "a2:80"), b},
+			waitErr: map[string]error{"a>a2:80": errors.New("unreachable")},
+			want:    []string{"start a>a2:80", "stop a>a2:80"},
+			working: []string{"a>a1:80", "b>b1:80"},
+		},
+		{
+			name:    "failed does not keep the others",
+			tasks:   []config.Chain{a, c},
+			waitErr: map[string]error{"c>c1:80": errors.New("unreachable")},
+			want:    []string{"start c>c1:80", "stop c>c1:80", "stop b>b1:80"},
+			working: []string{"a>a1:80"},
+		},
+		{
+			name:    "disabled",
+			tasks:   []config.Chain{a, {Name: "b", Disabled: true, Bind: b.Bind, Proxy: b.Proxy}},
+			want:    []string{"stop b>b1:80"},
+			working: []string{"a>a1:80"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeChains{}
+			r := &Reloader{
+				Start: f.start,
+			}
+			ctx := context.Background()
+			r.Reload(ctx, logger.Std, []config.Chain{a, b}, true)
+			f.take()
+
+			f.waitErr = tt.waitErr
+			f.updateErr = tt.updateErr
+			r.Reload(ctx, logger.Std, tt.tasks, false)
+			got := f.take()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+			if working := workingChains(r); !reflect.DeepEqual(working, tt.working) {
+				t.Errorf("working = %q, want %q", working, tt.working)
+			}
+		})
+	}
+}
+
+func TestReloadInitialFailed(t *testing.T) {
+	a := newChain("a", ":1000", "a1:80")
+	f := &fakeChains{
+		waitErr: map[string]error{"a>a1:80": errors.New("not ready")},
+	}
+	r := &Reloader{
+		Start: f.start,
+	}
+	r.Reload(context.Background(), logger.Std, []config.Chain{a}, true)
+	want := []string{"start a>a1:80"}
+	if got := f.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if working := workingChains(r); !reflect.DeepEqual(working, []string{"a>a1:80"}) {
+		t.Errorf("working = %q, want the failed chain to keep retrying", working)
+	}
+}
+
+func workingChains(r *Reloader) []string {
+	var names []string
+	for _, t := range r.working {
+		names = append(names, t.Config.Name+">"+t.Config.Proxy[0].LB[0])
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,55 @@
+package route
+
+import (
+	"github.com/wzshiming/hostmatcher"
+)
+
+// HostMatcher is the hostmatcher.Matcher that also matches the entries of the list: sources.
+type HostMatcher struct {
+	inline hostmatcher.Matcher
+	lists  []*List
+}
+
+// NewHostMatcher returns the matcher of the hosts.
+func NewHostMatcher(hosts []string) (*HostMatcher, error) {
+	m := &HostMatcher{}
+	var inline []string
+	for _, host := range hosts {
+		path, ok := IsList(host)
+		if !ok {
+			inline = append(inline, host)
+			continue
+		}
+		l, err := OpenList(path)
+		if err != nil {
+			return nil, err
+		}
+		m.lists = append(m.lists, l)
+	}
+	if len(inline) != 0 {
+		m.inline = hostmatcher.NewMatcher(inline)
+	}
+	return m, nil
+}
+
+// Match reports whether the address, which is host:port or host, matches.
+func (m *HostMatcher) Match(address string) bool {
+	if m.inline != nil && m.inline.Match(address) {
+		return true
+	}
+	if len(m.lists) == 0 {
+		return false
+	}
+	host := splitHost(address)
+	for _, l := range m.lists {
+		if l.Set().Match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists returns the list: sources to watch.
+func (m *HostMatcher) Lists() []*List {
+	return m.lists
+}
@@ -0,0 +1,158 @@
+package route
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/wzshiming/bridge/internal/watch"
+)
+
+// ListPrefix is the prefix of the values that load the entries from a file, such as "list:/etc/bridge/corp.txt".
+const ListPrefix = "list:"
+
+// IsList reports whether the value is a list: source, and returns the path of the file.
+func IsList(value string) (string, bool) {
+	return strings.CutPrefix(value, ListPrefix)
+}
+
+// HostSet is the compiled entries of a List.
+type HostSet struct {
+	Domains  DomainSet
+	Prefixes PrefixSet
+}
+
+// Add adds the entry, which is a domain suffix, an IP or a CIDR.
+func (h *HostSet) Add(entry string) error {
+	if prefix, err := netip.ParsePrefix(entry); err == nil {
+		h.Prefixes.Add(prefix.Masked())
+		return nil
+	}
+	if addr, err := netip.ParseAddr(entry); err == nil {
+		h.Prefixes.Add(netip.PrefixFrom(addr, addr.BitLen()))
+		return nil
+	}
+	domain := normalizeDomain(entry)
+	if domain == "" || strings.ContainsAny(domain, ":/ \t*") {
+		return fmt.Errorf("invalid entry %q", entry)
+	}
+	h.Domains.Add(domain)
+	return nil
+}
+
+// Match reports whether the host, which is a domain or an IP, is in the set.
+func (h *HostSet) Match(host string) bool {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return h.Prefixes.Contains(ip)
+	}
+	return h.Domains.Match(host)
+}
+
+// ParseHostSet reads the entries, one per line, the blank lines and the text after # are ignored.
+func ParseHostSet(r io.Reader) (*HostSet, error) {
+	h := &HostSet{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		err := h.Add(entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// List is the HostSet loaded from a file, which is reloaded by Watch.
+type List struct {
+	Path string
+	set  atomic.Pointer[HostSet]
+}
+
+// OpenList loads the list from the file.
+func OpenList(path string) (*List, error) {
+	l := &List{
+		Path: path,
+	}
+	err := l.Load()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Load reads the file again, the current entries are kept if it fails.
+func (l *List) Load() error {
+	f, err := os.Open(l.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	set, err := ParseHostSet(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", l.Path, err)
+	}
+	l.set.Store(set)
+	return nil
+}
+
+// Set returns the current entries.
+func (l *List) Set() *HostSet {
+	return l.set.Load()
+}
+
+// listPollInterval is the polling interval of the lists when inotify is not available.
+const listPollInterval = 10 * time.Second
+
+// Watch reloads the list when the file changes until the ctx is done.
+func (l *List) Watch(ctx context.Context, log *slog.Logger) {
+	w := &watch.Watcher{
+		Sources: func() ([]string, []string) {
+			return []string{l.Path}, []string{filepath.Dir(l.Path)}
+		},
+		OnChange: func() {
+			err := l.Load()
+			if err != nil {
+				log.Error("Reload list", "path", l.Path, "err", err)
+				return
+			}
+			set := l.Set()
+			log.Info("Reload list", "path", l.Path, "domains", set.Domains.Len(), "prefixes", set.Prefixes.Len())
+		},
+		Logger:   log,
+		Interval: listPollInterval,
+		Debounce: time.Second / 2,
+	}
+	w.Run(ctx)
+}
+
+// WatchLists reloads the lists when their files change until the ctx is done.
+func WatchLists(ctx context.Context, log *slog.Logger, lists []*List) {
+	for _, l := range lists {
+		go l.Watch(ctx, log)
+	}
+}
+
+// splitHost returns the host of the address, which may have no port.
+func splitHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
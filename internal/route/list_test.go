@@ -0,0 +1,130 @@
+package route
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostSet(t *testing.T) {
+	set, err := ParseHostSet(strings.NewReader(`
+# corp
+corp
+*.Example.org # the comment
+a.example.org
+10.0.0.0/8
+10.1.0.0/16
+192.168.1.1
+fd00::/8
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := set.Domains.Len(), 2; got != want {
+		t.Errorf("Domains.Len() = %d, want %d", got, want)
+	}
+	if got, want := set.Prefixes.Len(), 3; got != want {
+		t.Errorf("Prefixes.Len() = %d, want %d", got, want)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "corp", want: true},
+		{host: "git.corp.", want: true},
+		{host: "b.EXAMPLE.org", want: true},
+		{host: "example.org", want: true},
+		{host: "org"},
+		{host: "notcorp"},
+		{host: "10.255.0.1", want: true},
+		{host: "11.0.0.1"},
+		{host: "192.168.1.1", want: true},
+		{host: "192.168.1.2"},
+		{host: "::ffff:10.0.0.1", want: true},
+		{host: "fd12::1", want: true},
+		{host: "fe80::1"},
+	}
+	for _, tt := range tests {
+		if got := set.Match(tt.host); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestHostSetLenCovered(t *testing.T) {
+	// The longer ones are added before the shorter ones that cover them.
+	set, err := ParseHostSet(strings.NewReader(`
+a.example.org
+b.example.org
+example.org
+10.1.0.0/16
+10.2.0.0/16
+10.0.0.0/8
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := set.Domains.Len(), 1; got != want {
+		t.Errorf("Domains.Len() = %d, want %d", got, want)
+	}
+	if got, want := set.Prefixes.Len(), 1; got != want {
+		t.Errorf("Prefixes.Len() = %d, want %d", got, want)
+	}
+}
+
+func TestParseHostSetError(t *testing.T) {
+	_, err := ParseHostSet(strings.NewReader("corp\nexample.org:80\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseHostSet() error = %v, want the error of line 2", err)
+	}
+}
+
+func TestPrefixSetCovered(t *testing.T) {
+	set := &PrefixSet{}
+	set.Add(netip.MustParsePrefix("10.1.0.0/16"))
+	set.Add(netip.MustParsePrefix("10.0.0.0/8"))
+	if !set.Contains(netip.MustParseAddr("10.2.0.1")) {
+		t.Errorf("the shorter prefix added later is not matched")
+	}
+}
+
+func TestListWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	err := os.WriteFile(path, []byte("corp\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewHostMatcher([]string{"localhost", ListPrefix + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Match("localhost:80") || !m.Match("git.corp:22") || m.Match("example.org:80") {
+		t.Fatalf("unexpected match of the initial list")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	WatchLists(ctx, slog.New(slog.DiscardHandler), m.Lists())
+	time.Sleep(100 * time.Millisecond)
+
+	err = os.WriteFile(path, []byte("example.org\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.Match("example.org:80") {
+		if time.Now().After(deadline) {
+			t.Fatalf("the list is not reloaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if m.Match("git.corp:22") {
+		t.Errorf("the removed entry is still matched")
+	}
+}
@@ -0,0 +1,91 @@
+package route
+
+import (
+	"net/netip"
+)
+
+// PrefixSet is the set of the IP prefixes in a binary radix tree.
+type PrefixSet struct {
+	v4   prefixNode
+	v6   prefixNode
+	size int
+}
+
+type prefixNode struct {
+	child [2]*prefixNode
+	// end is true if a prefix ends at the node.
+	end bool
+}
+
+// Add adds the prefix, the IPv4-mapped IPv6 prefixes are added as IPv4.
+func (s *PrefixSet) Add(prefix netip.Prefix) {
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+	}
+	node := s.root(addr)
+	b := addr.AsSlice()
+	for i := 0; i < bits; i++ {
+		if node.end {
+			// It is covered by the shorter prefix.
+			return
+		}
+		bit := b[i/8] >> (7 - i%8) & 1
+		if node.child[bit] == nil {
+			node.child[bit] = &prefixNode{}
+		}
+		node = node.child[bit]
+	}
+	if !node.end {
+		// The longer prefixes are covered by it now.
+		s.size -= node.count()
+		node.end = true
+		node.child = [2]*prefixNode{}
+		s.size++
+	}
+}
+
+// count returns the number of the prefixes that end at or under the node.
+func (n *prefixNode) count() int {
+	if n.end {
+		return 1
+	}
+	var c int
+	for _, child := range n.child {
+		if child != nil {
+			c += child.count()
+		}
+	}
+	return c
+}
+
+// Contains reports whether the IP is in any prefix of the set.
+func (s *PrefixSet) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	node := s.root(ip)
+	b := ip.AsSlice()
+	for i := 0; ; i++ {
+		if node.end {
+			return true
+		}
+		if i == len(b)*8 {
+			return false
+		}
+		node = node.child[b[i/8]>>(7-i%8)&1]
+		if node == nil {
+			return false
+		}
+	}
+}
+
+// Len returns the number of the prefixes, not counting the ones covered by the shorter ones.
+func (s *PrefixSet) Len() int {
+	return s.size
+}
+
+func (s *PrefixSet) root(addr netip.Addr) *prefixNode {
+	if addr.Is4() {
+		return &s.v4
+	}
+	return &s.v6
+}
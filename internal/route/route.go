@@ -0,0 +1,219 @@
+package route
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Conditions of a Matcher, see config.Rule.
+type Conditions struct {
+	Domain  []string
+	Keyword []string
+	Regex   []string
+	CIDR    []string
+	Port    []string
+	Network []string
+}
+
+// Matcher matches the destinations by the Conditions.
+type Matcher struct {
+	domains     *DomainSet
+	domainLists []*List
+	keywords    []string
+	regexps     []*regexp.Regexp
+	prefixes    *PrefixSet
+	cidrLists   []*List
+	ports       [][2]int
+	networks    []string
+}
+
+// NewMatcher returns the Matcher of the conditions.
+func NewMatcher(c Conditions) (*Matcher, error) {
+	m := &Matcher{
+		keywords: c.Keyword,
+		networks: c.Network,
+	}
+	for _, domain := range c.Domain {
+		if path, ok := IsList(domain); ok {
+			l, err := OpenList(path)
+			if err != nil {
+				return nil, err
+			}
+			m.domainLists = append(m.domainLists, l)
+			continue
+		}
+		domain = normalizeDomain(domain)
+		if domain == "" {
+			return nil, fmt.Errorf("empty domain")
+		}
+		if m.domains == nil {
+			m.domains = &DomainSet{}
+		}
+		m.domains.Add(domain)
+	}
+	for _, expr := range c.Regex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		m.regexps = append(m.regexps, re)
+	}
+	for _, cidr := range c.CIDR {
+		if path, ok := IsList(cidr); ok {
+			l, err := OpenList(path)
+			if err != nil {
+				return nil, err
+			}
+			m.cidrLists = append(m.cidrLists, l)
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if m.prefixes == nil {
+			m.prefixes = &PrefixSet{}
+		}
+		m.prefixes.Add(prefix.Masked())
+	}
+	for _, port := range c.Port {
+		r, err := parsePortRange(port)
+		if err != nil {
+			return nil, err
+		}
+		m.ports = append(m.ports, r)
+	}
+	for _, network := range c.Network {
+		switch network {
+		case "tcp", "unix":
+		default:
+			return nil, fmt.Errorf("unsupported network %q", network)
+		}
+	}
+	return m, nil
+}
+
+func parsePortRange(s string) ([2]int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		to = from
+	}
+	start, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return [2]int{}, fmt.Errorf("invalid port %q", s)
+	}
+	end, err := strconv.ParseUint(to, 10, 16)
+	if err != nil || end < start {
+		return [2]int{}, fmt.Errorf("invalid port %q", s)
+	}
+	return [2]int{int(start), int(end)}, nil
+}
+
+// Match reports whether the destination matches, the address is host:port or the path of unix.
+func (m *Matcher) Match(network, address string) bool {
+	if len(m.networks) != 0 && !m.matchNetwork(network) {
+		return false
+	}
+	host, port := address, -1
+	if !strings.HasPrefix(network, "unix") {
+		if h, p, err := net.SplitHostPort(address); err == nil {
+			host = h
+			if n, err := strconv.Atoi(p); err == nil {
+				port = n
+			}
+		}
+	}
+	if len(m.ports) != 0 && !m.matchPort(port) {
+		return false
+	}
+
+	ip, err := netip.ParseAddr(host)
+	isIP := err == nil
+	if (m.prefixes != nil || len(m.cidrLists) != 0) && !(isIP && m.matchIP(ip)) {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSuffix(host, "."))
+	if (m.domains != nil || len(m.domainLists) != 0) && !(!isIP && m.matchDomain(domain)) {
+		return false
+	}
+	if len(m.keywords) != 0 && !(!isIP && m.matchKeyword(domain)) {
+		return false
+	}
+	if len(m.regexps) != 0 && !(!isIP && m.matchRegex(domain)) {
+		return false
+	}
+	return true
+}
+
+func (m *Matcher) matchNetwork(network string) bool {
+	for _, n := range m.networks {
+		if strings.HasPrefix(network, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchPort(port int) bool {
+	for _, r := range m.ports {
+		if port >= r[0] && port <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchIP(ip netip.Addr) bool {
+	if m.prefixes != nil && m.prefixes.Contains(ip) {
+		return true
+	}
+	for _, l := range m.cidrLists {
+		if l.Set().Prefixes.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchDomain(domain string) bool {
+	if m.domains != nil && m.domains.Match(domain) {
+		return true
+	}
+	for _, l := range m.domainLists {
+		if l.Set().Domains.Match(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists returns the list: sources to watch.
+func (m *Matcher) Lists() []*List {
+	return append(append([]*List(nil), m.domainLists...), m.cidrLists...)
+}
+
+func (m *Matcher) matchKeyword(domain string) bool {
+	for _, keyword := range m.keywords {
+		if strings.Contains(domain, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchRegex(domain string) bool {
+	for _, re := range m.regexps {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+	return false
+}
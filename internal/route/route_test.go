@@ -0,0 +1,137 @@
+package route
+
+import (
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Conditions
+		network string
+		address string
+		want    bool
+	}{
+		{
+			name:    "all",
+			network: "tcp",
+			address: "example.org:80",
+			want:    true,
+		},
+		{
+			name:    "domain",
+			c:       Conditions{Domain: []string{"*.corp"}},
+			network: "tcp",
+			address: "git.CORP:22",
+			want:    true,
+		},
+		{
+			name:    "domain itself",
+			c:       Conditions{Domain: []string{"corp"}},
+			network: "tcp",
+			address: "corp:22",
+			want:    true,
+		},
+		{
+			name:    "domain suffix of the label",
+			c:       Conditions{Domain: []string{"corp"}},
+			network: "tcp",
+			address: "notcorp:22",
+		},
+		{
+			name:    "keyword",
+			c:       Conditions{Keyword: []string{"google"}},
+			network: "tcp",
+			address: "www.google.com:443",
+			want:    true,
+		},
+		{
+			name:    "regex",
+			c:       Conditions{Regex: []string{`^ads?\.`}},
+			network: "tcp",
+			address: "ad.example.org:443",
+			want:    true,
+		},
+		{
+			name:    "cidr",
+			c:       Conditions{CIDR: []string{"10.0.0.0/8"}},
+			network: "tcp",
+			address: "10.1.2.3:80",
+			want:    true,
+		},
+		{
+			name:    "cidr of ipv6",
+			c:       Conditions{CIDR: []string{"fd00::/8"}},
+			network: "tcp",
+			address: "[fd00::1]:80",
+			want:    true,
+		},
+		{
+			name:    "cidr does not match the domain",
+			c:       Conditions{CIDR: []string{"10.0.0.0/8"}},
+			network: "tcp",
+			address: "example.org:80",
+		},
+		{
+			name:    "port range",
+			c:       Conditions{Port: []string{"22", "8000-9000"}},
+			network: "tcp",
+			address: "example.org:8080",
+			want:    true,
+		},
+		{
+			name:    "port out of range",
+			c:       Conditions{Port: []string{"8000-9000"}},
+			network: "tcp",
+			address: "example.org:80",
+		},
+		{
+			name:    "network",
+			c:       Conditions{Network: []string{"tcp"}},
+			network: "tcp4",
+			address: "example.org:80",
+			want:    true,
+		},
+		{
+			name:    "unix",
+			c:       Conditions{Network: []string{"unix"}, Keyword: []string{"docker"}},
+			network: "unix",
+			address: "/var/run/docker.sock",
+			want:    true,
+		},
+		{
+			name:    "all conditions",
+			c:       Conditions{Domain: []string{"corp"}, Port: []string{"443"}},
+			network: "tcp",
+			address: "git.corp:22",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Match(tt.network, tt.address); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMatcherError(t *testing.T) {
+	tests := []Conditions{
+		{CIDR: []string{"10.0.0.0/33"}},
+		{Port: []string{"9000-8000"}},
+		{Port: []string{"http"}},
+		{Regex: []string{"("}},
+		{Network: []string{"udp"}},
+		{Domain: []string{"*."}},
+	}
+	for _, c := range tests {
+		_, err := NewMatcher(c)
+		if err == nil {
+			t.Errorf("NewMatcher(%+v) is expected to fail", c)
+		}
+	}
+}
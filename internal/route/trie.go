@@ -0,0 +1,101 @@
+package route
+
+import (
+	"strings"
+)
+
+// DomainSet is the set of the domain suffixes in a trie of the labels.
+type DomainSet struct {
+	root domainNode
+	size int
+}
+
+type domainNode struct {
+	children map[string]*domainNode
+	// end is true if the suffix ends at the node.
+	end bool
+}
+
+// Add adds the domain suffix, "corp", ".corp" and "*.corp" all match "corp" and "a.corp".
+func (s *DomainSet) Add(domain string) {
+	domain = normalizeDomain(domain)
+	node := &s.root
+	for domain != "" {
+		label := domain
+		i := strings.LastIndexByte(domain, '.')
+		if i >= 0 {
+			label = domain[i+1:]
+			domain = domain[:i]
+		} else {
+			domain = ""
+		}
+		if node.end {
+			// It is covered by the shorter suffix.
+			return
+		}
+		child := node.children[label]
+		if child == nil {
+			if node.children == nil {
+				node.children = map[string]*domainNode{}
+			}
+			child = &domainNode{}
+			node.children[label] = child
+		}
+		node = child
+	}
+	if !node.end {
+		// The longer suffixes are covered by it now.
+		s.size -= node.count()
+		node.end = true
+		node.children = nil
+		s.size++
+	}
+}
+
+// count returns the number of the suffixes that end at or under the node.
+func (n *domainNode) count() int {
+	if n.end {
+		return 1
+	}
+	var c int
+	for _, child := range n.children {
+		c += child.count()
+	}
+	return c
+}
+
+// Match reports whether the domain has any suffix of the set.
+func (s *DomainSet) Match(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	node := &s.root
+	for domain != "" {
+		label := domain
+		i := strings.LastIndexByte(domain, '.')
+		if i >= 0 {
+			label = domain[i+1:]
+			domain = domain[:i]
+		} else {
+			domain = ""
+		}
+		node = node.children[label]
+		if node == nil {
+			return false
+		}
+		if node.end {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of the suffixes, not counting the ones covered by the shorter ones.
+func (s *DomainSet) Len() int {
+	return s.size
+}
+
+func normalizeDomain(domain string) string {
+	domain = strings.TrimPrefix(domain, "*")
+	domain = strings.TrimPrefix(domain, ".")
+	domain = strings.TrimSuffix(domain, ".")
+	return strings.ToLower(domain)
+}
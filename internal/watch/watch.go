@@ -0,0 +1,134 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher calls OnChange when the contents of the files change.
+type Watcher struct {
+	// Sources returns the files to compare and the directories to watch.
+	Sources  func() (files []string, dirs []string)
+	OnChange func()
+	Logger   *slog.Logger
+	// Interval is the polling interval when inotify is not available.
+	Interval time.Duration
+	// Debounce is the time to wait for the events to settle.
+	Debounce time.Duration
+
+	notify  *fsnotify.Watcher
+	watched map[string]struct{}
+	ticker  *time.Ticker
+	last    string
+}
+
+// Run watches until the ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	files, dirs := w.Sources()
+	w.last = fingerprint(files)
+
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.poll(err)
+	} else {
+		defer notify.Close()
+		w.notify = notify
+		w.watched = map[string]struct{}{}
+		w.watch(dirs)
+	}
+	defer func() {
+		if w.ticker != nil {
+			w.ticker.Stop()
+		}
+	}()
+
+	debounce := time.NewTimer(w.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		var events <-chan fsnotify.Event
+		var errors <-chan error
+		var ticker <-chan time.Time
+		if w.notify != nil {
+			events = w.notify.Events
+			errors = w.notify.Errors
+		}
+		if w.ticker != nil {
+			ticker = w.ticker.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-events:
+			debounce.Reset(w.Debounce)
+		case err := <-errors:
+			w.Logger.Warn("Watch", "err", err)
+		case <-debounce.C:
+			w.check()
+		case <-ticker:
+			w.check()
+		}
+	}
+}
+
+// poll falls back to polling.
+func (w *Watcher) poll(err error) {
+	if w.ticker != nil {
+		return
+	}
+	w.Logger.Warn("Fallback to polling", "err", err, "interval", w.Interval)
+	w.ticker = time.NewTicker(w.Interval)
+}
+
+func (w *Watcher) watch(dirs []string) {
+	if w.notify == nil {
+		return
+	}
+	for _, dir := range dirs {
+		if _, ok := w.watched[dir]; ok {
+			continue
+		}
+		err := w.notify.Add(dir)
+		if err != nil {
+			w.poll(err)
+			continue
+		}
+		w.watched[dir] = struct{}{}
+	}
+}
+
+func (w *Watcher) check() {
+	files, dirs := w.Sources()
+	w.watch(dirs)
+	current := fingerprint(files)
+	if current == w.last {
+		return
+	}
+	w.last = current
+	w.Logger.Info("Config changed")
+	w.OnChange()
+}
+
+func fingerprint(files []string) string {
+	h := sha256.New()
+	for _, file := range files {
+		io.WriteString(h, file)
+		h.Write([]byte{0})
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		io.Copy(h, f)
+		f.Close()
+		h.Write([]byte{0})
+	}
+	return string(h.Sum(nil))
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wzshiming/bridge/logger"
+)
+
+func TestWatcherSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The layout of a Kubernetes ConfigMap volume.
+	write("..v1/bridge.yaml", "v1")
+	write("..v2/bridge.yaml", "v2")
+	err := os.Symlink("..v1", filepath.Join(dir, "..data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("..data/bridge.yaml", filepath.Join(dir, "bridge.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 1)
+	w := &Watcher{
+		Sources: func() ([]string, []string) {
+			return []string{filepath.Join(dir, "bridge.yaml")}, []string{dir}
+		},
+		OnChange: func() {
+			changed <- struct{}{}
+		},
+		Logger:   logger.Std,
+		Interval: time.Second / 10,
+		Debounce: time.Second / 10,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// Wait for the watcher to start.
+	time.Sleep(time.Second / 5)
+
+	err = os.Symlink("..v2", filepath.Join(dir, "..data_tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change is not noticed")
+	}
+
+	// Touching without changing the contents is ignored.
+	write("..v2/bridge.yaml", "v2")
+	select {
+	case <-changed:
+		t.Fatal("unexpected change")
+	case <-time.After(time.Second):
+	}
+}
@@ -2,6 +2,9 @@ package ssh
 
 import (
 	"context"
+	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/wzshiming/bridge"
 	"github.com/wzshiming/sshproxy"
@@ -13,8 +16,64 @@ func SSH(ctx context.Context, dialer bridge.Dialer, addr string) (bridge.Dialer,
 	if err != nil {
 		return nil, err
 	}
+	proxyDial := (&net.Dialer{}).DialContext
 	if dialer != nil {
-		d.ProxyDial = dialer.DialContext
+		proxyDial = dialer.DialContext
 	}
-	return d, nil
+	s := &sshDialer{Dialer: d}
+	d.ProxyDial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := proxyDial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		s.dialed.Store(true)
+		s.open.Add(1)
+		return &transportConn{Conn: conn, open: &s.open}, nil
+	}
+	return s, nil
+}
+
+// sshDialer reports whether the connections to the ssh server are gone.
+type sshDialer struct {
+	*sshproxy.Dialer
+	dialed atomic.Bool
+	// open is the number of the connections to the ssh server that are not gone.
+	open atomic.Int64
+}
+
+// Closed reports whether all connections to the ssh server are gone.
+func (s *sshDialer) Closed() bool {
+	return s.dialed.Load() && s.open.Load() == 0
+}
+
+// Handshake connects to the ssh server without dialing through it.
+func (s *sshDialer) Handshake(ctx context.Context) error {
+	_, err := s.SSHClient(ctx)
+	return err
+}
+
+// transportConn is the connection to the ssh server, which is counted as gone on error.
+type transportConn struct {
+	net.Conn
+	once sync.Once
+	open *atomic.Int64
+}
+
+func (c *transportConn) gone() {
+	c.once.Do(func() {
+		c.open.Add(-1)
+	})
+}
+
+func (c *transportConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.gone()
+	}
+	return n, err
+}
+
+func (c *transportConn) Close() error {
+	c.gone()
+	return c.Conn.Close()
 }